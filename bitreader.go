@@ -0,0 +1,149 @@
+/*
+
+Bit reader implementation with look-ahead.
+
+*/
+
+package huffman
+
+import (
+	"bufio"
+	"io"
+)
+
+// BitPeeker is a source of bits which allows looking ahead.
+// Table.Decode() reads Huffman codes from a BitPeeker.
+type BitPeeker interface {
+	// PeekBits returns the next n bits as the lowest n bits of u, without consuming them.
+	// If less than n bits are left, the missing (lowest) bits of u are 0s, avail tells
+	// the number of valid bits, and err tells why no more bits are available (io.EOF at the end of the input).
+	PeekBits(n uint8) (u uint64, avail uint8, err error)
+
+	// SkipBits consumes the next n bits, which must have been available by the previous PeekBits() call.
+	SkipBits(n uint8)
+}
+
+// maxPeekBits is the max number of bits that can be peeked with BitReader.PeekBits().
+const maxPeekBits = 56
+
+// BitReader is a bit reader implementation which reads ahead and so it is able to
+// implement BitPeeker. For convenience, it also implements io.Reader and io.ByteReader.
+//
+// Since BitReader reads ahead, the source must not be read by others while the BitReader is in use.
+type BitReader struct {
+	in    io.ByteReader
+	buf   *bufio.Reader // buffer wrapping the source if it does not implement io.ByteReader (kept for reuse)
+	cache uint64        // unread bits are stored here (the lowest bits)
+	bits  uint8         // number of unread bits in cache
+	err   error         // error that prevented filling the cache
+}
+
+// NewBitReader returns a new BitReader using the specified io.Reader as the input (source).
+func NewBitReader(in io.Reader) *BitReader {
+	r := &BitReader{}
+	r.Reset(in)
+	return r
+}
+
+// Reset discards the state of the BitReader (including unread bits and errors),
+// and makes it read from the specified io.Reader.
+// The internal buffer (used if the source does not implement io.ByteReader) is reused.
+func (r *BitReader) Reset(in io.Reader) {
+	bin, ok := in.(io.ByteReader)
+	if !ok {
+		if r.buf == nil {
+			r.buf = bufio.NewReader(in)
+		} else {
+			r.buf.Reset(in)
+		}
+		bin = r.buf
+	}
+	*r = BitReader{in: bin, buf: r.buf}
+}
+
+// fill tries to read bytes into the cache so it has at least n bits.
+func (r *BitReader) fill(n uint8) {
+	for r.bits < n && r.err == nil {
+		var b byte
+		if b, r.err = r.in.ReadByte(); r.err != nil {
+			return
+		}
+		r.cache = r.cache<<8 | uint64(b)
+		r.bits += 8
+	}
+}
+
+// PeekBits returns the next n bits as the lowest n bits of u, without consuming them.
+// n must not be greater than 56.
+//
+// PeekBits implements BitPeeker.
+func (r *BitReader) PeekBits(n uint8) (u uint64, avail uint8, err error) {
+	r.fill(n)
+	if r.bits >= n {
+		return r.cache >> (r.bits - n) & (1<<n - 1), n, nil
+	}
+	return r.cache << (n - r.bits) & (1<<n - 1), r.bits, r.err
+}
+
+// SkipBits consumes the next n bits, which must have been available by the previous PeekBits() call.
+//
+// SkipBits implements BitPeeker.
+func (r *BitReader) SkipBits(n uint8) {
+	r.bits -= n
+	r.cache &= 1<<r.bits - 1
+}
+
+// ReadBits reads n bits and returns them as the lowest n bits of u.
+func (r *BitReader) ReadBits(n uint8) (u uint64, err error) {
+	if n > maxPeekBits {
+		if u, err = r.ReadBits(n - 32); err != nil {
+			return
+		}
+		var lo uint64
+		lo, err = r.ReadBits(32)
+		return u<<32 | lo, err
+	}
+
+	u, avail, err := r.PeekBits(n)
+	if avail < n {
+		return 0, err
+	}
+	r.SkipBits(n)
+	return u, nil
+}
+
+// ReadBool reads the next bit, and returns true if it is 1.
+func (r *BitReader) ReadBool() (b bool, err error) {
+	u, err := r.ReadBits(1)
+	return u == 1, err
+}
+
+// ReadByte reads the next 8 bits and returns them as a byte.
+//
+// ReadByte implements io.ByteReader.
+func (r *BitReader) ReadByte() (b byte, err error) {
+	u, err := r.ReadBits(8)
+	return byte(u), err
+}
+
+// Read reads up to len(p) bytes (8 * len(p) bits) from the underlying reader.
+//
+// Read implements io.Reader, and gives a byte-level view of the bit stream.
+func (r *BitReader) Read(p []byte) (n int, err error) {
+	for ; n < len(p); n++ {
+		if p[n], err = r.ReadByte(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Align aligns the bit stream to a byte boundary,
+// so next read will read/use data from the next byte.
+// Returns the number of unread / skipped bits.
+func (r *BitReader) Align() (skipped uint8) {
+	// Cache is filled with whole bytes, so the unaligned bits are the "remainder":
+	skipped = r.bits % 8
+	r.SkipBits(skipped)
+	return
+}
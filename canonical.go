@@ -0,0 +1,171 @@
+/*
+
+Canonical Huffman code implementation.
+
+*/
+
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	// ErrOversubscribed is returned if code lengths are over-subscribed:
+	// there are more codes of some length than available (the Kraft sum is greater than 1).
+	ErrOversubscribed = errors.New("huffman: over-subscribed code lengths")
+
+	// ErrIncomplete is returned if code lengths are incomplete:
+	// some codes are unused (the Kraft sum is less than 1).
+	ErrIncomplete = errors.New("huffman: incomplete code lengths")
+)
+
+// Code describes the Huffman code of a value.
+type Code struct {
+	Value ValueType // Value the code belongs to
+	Code  uint64    // The code, its lowest Bits bits are used, first bit of the code is the highest
+	Bits  byte      // Length of the code in bits
+}
+
+// Canonical returns the canonical Huffman codes of the specified leaves of a Huffman tree.
+//
+// Only the code lengths are taken from the tree (as reported by Node.Code()), the codes are
+// then assigned as described by AssignCanonical(). This allows to transmit only the code lengths,
+// the receiver can reconstruct the identical codes by calling AssignCanonical().
+//
+// The returned slice is sorted by code length first, then by value.
+func Canonical(leaves []*Node) []Code {
+	codes := make([]Code, len(leaves))
+	for i, leaf := range leaves {
+		_, bits := leaf.Code()
+		codes[i] = Code{Value: leaf.Value, Bits: bits}
+	}
+	AssignCanonical(codes)
+	return codes
+}
+
+// CanonicalTree returns the canonical Huffman codes of all leaves of the specified Huffman tree.
+// See Canonical() for details.
+func CanonicalTree(root *Node) []Code {
+	return Canonical(Leaves(root))
+}
+
+// AssignCanonical assigns canonical Huffman codes based on the code lengths (Code.Bits).
+// The Code.Code fields are overwritten, the slice is sorted by code length first, then by value.
+//
+// Codes of the same length are consecutive integers in the order of values,
+// and shorter codes precede longer codes (lexicographically). This is the
+// same scheme used by DEFLATE and JPEG.
+//
+// Like in DEFLATE and JPEG, a code length of 0 means the value is absent (except if that is the only code,
+// see FromLengths()): such entries are skipped, their Code.Code fields are set to 0.
+func AssignCanonical(codes []Code) {
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].Bits != codes[j].Bits {
+			return codes[i].Bits < codes[j].Bits
+		}
+		return codes[i].Value < codes[j].Value
+	})
+
+	var code uint64
+	var prev byte // Length of the previous code, 0 before the first one
+	for i := range codes {
+		bits := codes[i].Bits
+		if bits == 0 {
+			codes[i].Code = 0
+			continue
+		}
+		if prev > 0 {
+			code = (code + 1) << (bits - prev)
+		}
+		codes[i].Code, prev = code, bits
+	}
+}
+
+// FromLengths builds the Huffman tree of the canonical codes (see AssignCanonical()) described by the
+// specified code lengths (Code.Bits), e.g. as found in DEFLATE or JPEG headers. Code.Code fields are ignored,
+// codes of zero length are skipped (their values are not present), except if that is the only code,
+// which results in a single leaf tree. The returned tree is compatible with Node.Code(), counts are zero.
+//
+// Code lengths are validated: they must describe a complete prefix code.
+// Returned errors wrap ErrOversubscribed or ErrIncomplete (describing the problem), or
+// ErrCodeTooLong or ErrDuplicateValue.
+func FromLengths(codes []Code) (*Node, error) {
+	if len(codes) != 1 {
+		var filtered []Code
+		for _, c := range codes {
+			if c.Bits > 0 {
+				filtered = append(filtered, c)
+			}
+		}
+		codes = filtered
+	}
+
+	values := make(map[ValueType]bool, len(codes))
+	for _, c := range codes {
+		if c.Bits > 64 {
+			return nil, ErrCodeTooLong
+		}
+		if values[c.Value] {
+			return nil, ErrDuplicateValue
+		}
+		values[c.Value] = true
+	}
+	if err := checkLengths(codes); err != nil {
+		return nil, err
+	}
+
+	leaves := make([]*Node, len(codes))
+	lengths := make([]byte, len(codes))
+	for i, c := range codes {
+		leaves[i] = &Node{Value: c.Value}
+		lengths[i] = c.Bits
+	}
+	return buildCanonical(leaves, lengths), nil
+}
+
+// checkLengths checks if the code lengths (Code.Bits) describe a complete prefix code.
+// A single code of length 0 is also considered complete. Code lengths must not exceed 64.
+// Returned errors wrap ErrOversubscribed or ErrIncomplete.
+func checkLengths(codes []Code) error {
+	if len(codes) == 0 {
+		return fmt.Errorf("%w: no codes", ErrIncomplete)
+	}
+	if len(codes) == 1 && codes[0].Bits == 0 {
+		return nil
+	}
+
+	var counts [65]int
+	maxBits := 0
+	for _, c := range codes {
+		if c.Bits == 0 {
+			return fmt.Errorf("%w: code of length 0 must be the only code", ErrOversubscribed)
+		}
+		counts[c.Bits]++
+		if int(c.Bits) > maxBits {
+			maxBits = int(c.Bits)
+		}
+	}
+
+	// left is the number of unused codes of the current length
+	left, remaining := 1, len(codes)
+	for bits := 1; bits <= maxBits; bits++ {
+		left = left*2 - counts[bits]
+		remaining -= counts[bits]
+		if left < 0 {
+			return fmt.Errorf("%w: %d codes of length %d, only %d available",
+				ErrOversubscribed, counts[bits], bits, left+counts[bits])
+		}
+		if bits < maxBits && left > remaining {
+			// Also prevents overflow of left
+			return fmt.Errorf("%w: %d unused codes of length %d, only %d longer codes",
+				ErrIncomplete, left, bits, remaining)
+		}
+	}
+	if left > 0 {
+		return fmt.Errorf("%w: %d unused codes of length %d", ErrIncomplete, left, maxBits)
+	}
+	return nil
+}
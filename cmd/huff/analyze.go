@@ -0,0 +1,102 @@
+/*
+
+The analyze command: code table and statistics of the Huffman code of an input.
+
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/icza/huffman"
+)
+
+// analyze runs the analyze command with the specified arguments (following the command), and returns the exit code.
+func analyze(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("huff analyze", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	dot := fs.Bool("dot", false, "print the tree in Graphviz DOT format instead of the code table")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintf(stderr, "Too many arguments\n%s", usage)
+		return 2
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	h := &huffman.Histogram{}
+	if _, err := io.Copy(h, in); err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	root := huffman.Build(h.Leaves())
+
+	var err error
+	if *dot {
+		err = huffman.Fprint(stdout, root, huffman.FormatDOT)
+	} else {
+		err = printAnalysis(stdout, root)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// printAnalysis prints the statistics and the code table of the tree.
+func printAnalysis(w io.Writer, root *huffman.Node) error {
+	if root == nil {
+		_, err := fmt.Fprintln(w, "No data.")
+		return err
+	}
+
+	s := huffman.Stats(root)
+	table, err := root.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	dataSize := (s.Bits + 7) / 8
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Input size:\t%d bytes\n", s.Total)
+	fmt.Fprintf(tw, "Distinct values:\t%d\n", s.Leaves)
+	fmt.Fprintf(tw, "Entropy:\t%.4f bit/symbol\n", s.Entropy)
+	fmt.Fprintf(tw, "Average code length:\t%.4f bit/symbol\n", s.AvgLen)
+	fmt.Fprintf(tw, "Redundancy:\t%.4f bit/symbol\n", s.Redundancy)
+	fmt.Fprintf(tw, "Code lengths:\t%d - %d bits\n", s.MinDepth, s.MaxDepth)
+	fmt.Fprintf(tw, "Encoded data size:\t%d bytes (%.2f %%)\n", dataSize, float64(dataSize)/float64(s.Total)*100)
+	fmt.Fprintf(tw, "With code table:\t%d bytes (%.2f %%)\n",
+		dataSize+uint64(len(table)), float64(dataSize+uint64(len(table)))/float64(s.Total)*100)
+
+	fmt.Fprintf(tw, "\nValue\tCount\tCode\n")
+	for _, leaf := range huffman.Leaves(root) {
+		r, bits := leaf.Code()
+		code := strconv.FormatUint(r, 2)
+		for len(code) < int(bits) {
+			code = "0" + code
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", strconv.QuoteRune(rune(leaf.Value)), leaf.Count, code[len(code)-int(bits):])
+	}
+	return tw.Flush()
+}
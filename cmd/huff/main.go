@@ -0,0 +1,225 @@
+/*
+
+Command huff compresses and decompresses data using Huffman coding (the hufio package).
+
+Usage:
+
+	huff compress [flags] [input [output]]
+	huff decompress [flags] [input [output]]
+	huff test [flags] [input]
+	huff analyze [flags] [input]
+
+If input is missing or "-", data is read from the standard input.
+If output is missing or "-", data is written to the standard output.
+If the command fails (e.g. the input is corrupted), the output file is removed, so no partial or invalid data is left behind.
+The test command decompresses the input and reports whether it is intact (verifying the checksum if present).
+The analyze command prints the Huffman code table of the bytes of the input with statistics
+(entropy, average code length, estimated compressed size), or the tree in Graphviz DOT format.
+
+Run huff <command> -h for the list of flags.
+
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/icza/huffman/hufio"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// usage is the usage text of the command.
+const usage = `Usage:
+	huff compress [flags] [input [output]]
+	huff decompress [flags] [input [output]]
+	huff test [flags] [input]
+	huff analyze [flags] [input]
+Run huff <command> -h for the list of flags.
+`
+
+// modes maps the values of the -mode flag to hufio modes.
+var modes = map[string]hufio.Mode{
+	"adaptive": hufio.ModeAdaptive,
+	"static":   hufio.ModeStatic,
+	"fgk":      hufio.ModeFGK,
+}
+
+// run runs the command with the specified arguments, and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd := args[0]
+	if cmd == "analyze" {
+		return analyze(args[1:], stdin, stdout, stderr)
+	}
+
+	fs := flag.NewFlagSet("huff "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var (
+		winSize     = fs.Int("winsize", 0, "size of the sliding window, 0 means the default, negative means no window")
+		mode        = fs.String("mode", "adaptive", "coding mode: adaptive, static or fgk (static buffers the whole input unless -block is set)")
+		blockSize   = fs.Int("block", 0, "block size, 0 means not to use blocks")
+		checksum    = fs.Bool("checksum", true, "append checksum to verify integrity")
+		header      = fs.Bool("header", true, "write / read stream header describing the options")
+		concurrency = fs.Int("concurrency", 0, "number of goroutines encoding / decoding blocks")
+		verbose     = fs.Bool("v", false, "report sizes and ratio on the standard error")
+	)
+
+	var maxArgs int
+	switch cmd {
+	case "compress", "decompress":
+		maxArgs = 2
+	case "test":
+		maxArgs = 1
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "Unknown command: %s\n%s", cmd, usage)
+		return 2
+	}
+
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > maxArgs {
+		fmt.Fprintf(stderr, "Too many arguments\n%s", usage)
+		return 2
+	}
+	m, ok := modes[strings.ToLower(*mode)]
+	if !ok {
+		fmt.Fprintf(stderr, "Invalid mode: %s\n", *mode)
+		return 2
+	}
+
+	o := &hufio.Options{
+		WinSize:     *winSize,
+		Mode:        m,
+		Header:      *header,
+		Checksum:    *checksum,
+		BlockSize:   *blockSize,
+		Concurrency: *concurrency,
+	}
+
+	in, out := &countReader{r: stdin}, &countWriter{w: stdout}
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in.r = f
+	}
+	var outFile *os.File
+	if cmd == "test" {
+		out.w = io.Discard
+	} else if name := fs.Arg(1); name != "" && name != "-" {
+		var err error
+		if outFile, err = os.Create(name); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		out.w = outFile
+	}
+
+	var err error
+	if cmd == "compress" {
+		err = compress(in, out, o)
+	} else {
+		err = decompress(in, out, o)
+	}
+	if outFile != nil {
+		if err2 := outFile.Close(); err == nil {
+			err = err2
+		}
+		if err != nil {
+			os.Remove(outFile.Name()) // Don't leave partial or invalid data behind
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+
+	if *verbose {
+		report(stderr, cmd, in.n, out.n)
+	}
+	return 0
+}
+
+// compress compresses in to out.
+func compress(in io.Reader, out io.Writer, o *hufio.Options) error {
+	w := hufio.NewWriterOptions(out, o)
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// decompress decompresses in to out.
+func decompress(in io.Reader, out io.Writer, o *hufio.Options) error {
+	r := hufio.NewReaderOptions(in, o)
+	if _, err := io.Copy(out, r); err != nil {
+		if errors.Is(err, hufio.ErrHeader) {
+			return fmt.Errorf("%w (was the input compressed with -header=false?)", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// report prints the sizes and ratio.
+func report(w io.Writer, cmd string, in, out int64) {
+	compressed, uncompressed := out, in
+	if cmd != "compress" {
+		compressed, uncompressed = in, out
+	}
+	if cmd == "test" {
+		fmt.Fprint(w, "OK. ")
+	}
+	fmt.Fprintf(w, "Uncompressed: %d bytes, compressed: %d bytes", uncompressed, compressed)
+	if uncompressed > 0 {
+		fmt.Fprintf(w, ", ratio: %.2f %%, %.2f bit/symbol",
+			float64(compressed)/float64(uncompressed)*100, float64(compressed)*8/float64(uncompressed))
+	}
+	fmt.Fprintln(w)
+}
+
+// countReader is an io.Reader which counts the bytes read.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n += int64(n)
+	return
+}
+
+// countWriter is an io.Writer which counts the bytes written.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	data, err := ioutil.ReadFile("../../hufio/_test_files/wiki_huffman.html_")
+	if err != nil {
+		t.Fatal("Can't read input:", err)
+	}
+
+	flagSets := [][]string{
+		nil,
+		{"-mode", "static"},
+		{"-mode", "FGK", "-block", "1000", "-concurrency", "4"},
+		{"-winsize", "-1", "-checksum=false"},
+	}
+	for _, flags := range flagSets {
+		name := strings.Join(flags, " ")
+
+		// Compress from stdin to stdout
+		compressed, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		args := append(append([]string{"compress"}, flags...), "-v")
+		if code := run(args, bytes.NewReader(data), compressed, stderr); code != 0 {
+			t.Fatalf("[%s] Got exit code: %d, stderr: %s", name, code, stderr)
+		}
+		if !strings.Contains(stderr.String(), "bit/symbol") {
+			t.Errorf("[%s] Missing report: %s", name, stderr)
+		}
+
+		// Decompress using the header
+		decompressed := &bytes.Buffer{}
+		if code := run([]string{"decompress", "-"}, bytes.NewReader(compressed.Bytes()), decompressed, stderr); code != 0 {
+			t.Fatalf("[%s] Got exit code: %d, stderr: %s", name, code, stderr)
+		}
+		if !bytes.Equal(decompressed.Bytes(), data) {
+			t.Errorf("[%s] Decompressed doesn't match original", name)
+		}
+	}
+
+	// Files, headerless stream
+	dir := t.TempDir()
+	in, out, out2 := filepath.Join(dir, "in"), filepath.Join(dir, "out.huf"), filepath.Join(dir, "out")
+	if err := ioutil.WriteFile(in, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if code := run([]string{"compress", "-header=false", "-mode", "static", in, out}, nil, stdout, stderr); code != 0 {
+		t.Fatalf("Got exit code: %d, stderr: %s", code, stderr)
+	}
+	if code := run([]string{"test", "-header=false", "-mode", "static", "-v", out}, nil, stdout, stderr); code != 0 ||
+		!strings.HasPrefix(stderr.String(), "OK.") {
+		t.Fatalf("Got exit code: %d, stderr: %s", code, stderr)
+	}
+	if code := run([]string{"decompress", "-header=false", "-mode", "static", out, out2}, nil, stdout, stderr); code != 0 {
+		t.Fatalf("Got exit code: %d, stderr: %s", code, stderr)
+	}
+	if data2, err := ioutil.ReadFile(out2); err != nil || !bytes.Equal(data2, data) {
+		t.Errorf("Decompressed doesn't match original, error: %v", err)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Unexpected output on stdout: %d bytes", stdout.Len())
+	}
+
+	// Corrupted input
+	compressed, _ := ioutil.ReadFile(out)
+	compressed[len(compressed)/2] ^= 0x10
+	stderr.Reset()
+	if code := run([]string{"test", "-header=false", "-mode", "static"}, bytes.NewReader(compressed), stdout, stderr); code != 1 {
+		t.Errorf("Got exit code: %d, want: 1, stderr: %s", code, stderr)
+	}
+	corrupted := filepath.Join(dir, "corrupted.huf")
+	if err := ioutil.WriteFile(corrupted, compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := run([]string{"decompress", "-header=false", "-mode", "static", corrupted, out2}, nil, stdout, ioutil.Discard); code != 1 {
+		t.Errorf("Got exit code: %d, want: 1", code)
+	}
+	if _, err := os.Stat(out2); !os.IsNotExist(err) {
+		t.Errorf("Output file of failed decompression must be removed, got: %v", err)
+	}
+
+	// Invalid usage
+	for _, args := range [][]string{nil, {"foo"}, {"compress", "-mode", "foo"}, {"test", "a", "b"}, {"compress", "-x"}} {
+		if code := run(args, nil, stdout, ioutil.Discard); code != 2 {
+			t.Errorf("[%v] Got exit code: %d, want: 2", args, code)
+		}
+	}
+	if code := run([]string{"decompress", filepath.Join(dir, "missing")}, nil, stdout, ioutil.Discard); code != 1 {
+		t.Errorf("Got exit code: %d, want: 1", code)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	input := "this is an example of a huffman tree"
+	if code := run([]string{"analyze"}, strings.NewReader(input), stdout, stderr); code != 0 {
+		t.Fatalf("Got exit code: %d, stderr: %s", code, stderr)
+	}
+	for _, exp := range []string{
+		"Input size:           36 bytes\n",
+		"Distinct values:      16\n",
+		"Average code length:  3.7500 bit/symbol\n",
+		"Encoded data size:    17 bytes (47.22 %)\n",
+		"' '    7      111\n",
+	} {
+		if !strings.Contains(stdout.String(), exp) {
+			t.Errorf("Missing %q from output:\n%s", exp, stdout)
+		}
+	}
+
+	stdout.Reset()
+	if code := run([]string{"analyze", "-dot", "-"}, strings.NewReader(input), stdout, stderr); code != 0 ||
+		!strings.HasPrefix(stdout.String(), "digraph huffman {") {
+		t.Errorf("Got exit code: %d, output: %s", code, stdout)
+	}
+
+	stdout.Reset()
+	if code := run([]string{"analyze"}, strings.NewReader(""), stdout, stderr); code != 0 || stdout.String() != "No data.\n" {
+		t.Errorf("Got exit code: %d, output: %s", code, stdout)
+	}
+
+	for _, args := range [][]string{{"analyze", "a", "b"}, {"analyze", "-x"}} {
+		if code := run(args, nil, stdout, ioutil.Discard); code != 2 {
+			t.Errorf("[%v] Got exit code: %d, want: 2", args, code)
+		}
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/icza/huffman
 
-go 1.13
+go 1.18
 
 require github.com/icza/bitio v1.0.0
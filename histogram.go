@@ -0,0 +1,118 @@
+/*
+
+Frequency counting and tree building helpers.
+
+*/
+
+package huffman
+
+import (
+	"io"
+	"sort"
+)
+
+// Histogram counts the occurrences of values, which can be used to build a Huffman tree.
+// Histograms of multiple shards of data can be merged.
+//
+// The zero value is an empty Histogram ready to use.
+//
+// Histogram implements io.Writer (counting the written bytes), so it can be the destination of io.Copy().
+type Histogram struct {
+	counts map[ValueType]int
+}
+
+// Add adds an occurrence of the value v.
+func (h *Histogram) Add(v ValueType) {
+	h.AddCount(v, 1)
+}
+
+// AddCount adds count occurrences of the value v.
+func (h *Histogram) AddCount(v ValueType, count int) {
+	if h.counts == nil {
+		h.counts = make(map[ValueType]int)
+	}
+	h.counts[v] += count
+}
+
+// Write counts the bytes of p. It always returns len(p), nil.
+//
+// Write implements io.Writer.
+func (h *Histogram) Write(p []byte) (n int, err error) {
+	var counts [256]int
+	for _, b := range p {
+		counts[b]++
+	}
+	for b, count := range counts {
+		if count > 0 {
+			h.AddCount(ValueType(b), count)
+		}
+	}
+	return len(p), nil
+}
+
+// Merge adds the counts of other to h.
+func (h *Histogram) Merge(other *Histogram) {
+	for v, count := range other.counts {
+		h.AddCount(v, count)
+	}
+}
+
+// Count returns the number of occurrences of the value v.
+func (h *Histogram) Count(v ValueType) int {
+	return h.counts[v]
+}
+
+// Len returns the number of distinct values having positive count.
+func (h *Histogram) Len() (n int) {
+	for _, count := range h.counts {
+		if count > 0 {
+			n++
+		}
+	}
+	return
+}
+
+// Leaves returns new leaves for the values having positive count, sorted by value
+// (so the tree built from them is deterministic).
+func (h *Histogram) Leaves() []*Node {
+	leaves := make([]*Node, 0, len(h.counts))
+	for v, count := range h.counts {
+		if count > 0 {
+			leaves = append(leaves, &Node{Value: v, Count: count})
+		}
+	}
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Value < leaves[j].Value })
+	return leaves
+}
+
+// Build builds a Huffman tree from the values having positive count.
+// Returns nil if there are no such values.
+func (h *Histogram) Build() *Node {
+	return Build(h.Leaves())
+}
+
+// FromBytes builds a Huffman tree of the bytes of data.
+// Returns nil if data is empty.
+func FromBytes(data []byte) *Node {
+	h := &Histogram{}
+	h.Write(data)
+	return h.Build()
+}
+
+// FromReader builds a Huffman tree of the bytes read from r until EOF.
+// Returns nil if there are no bytes to read.
+func FromReader(r io.Reader) (*Node, error) {
+	h := &Histogram{}
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Build(), nil
+}
+
+// FromCounts builds a Huffman tree from the specified value counts.
+// Values with non-positive count are ignored.
+// Returns nil if there are no values with positive count.
+func FromCounts(counts map[ValueType]int) *Node {
+	h := &Histogram{counts: counts}
+	return h.Build()
+}
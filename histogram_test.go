@@ -0,0 +1,71 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestHistogram(t *testing.T) {
+	data := []byte("this is an example of a huffman tree")
+
+	var h Histogram
+	if n, err := h.Write(data[:10]); n != 10 || err != nil {
+		t.Errorf("Got: %d, %v, want: %d, nil", n, err, 10)
+	}
+	var h2 Histogram
+	h2.Write(data[10:])
+	h.Merge(&h2)
+
+	if h.Len() != 16 || h.Count(' ') != 7 || h.Count('a') != 4 || h.Count('x') != 1 || h.Count('z') != 0 {
+		t.Errorf("Got: %d, %d, %d, %d, %d, want: 16, 7, 4, 1, 0",
+			h.Len(), h.Count(' '), h.Count('a'), h.Count('x'), h.Count('z'))
+	}
+
+	leaves := h.Leaves()
+	for i := 1; i < len(leaves); i++ {
+		if leaves[i-1].Value >= leaves[i].Value {
+			t.Errorf("Leaves not sorted by value: %v, %v", leaves[i-1].Value, leaves[i].Value)
+		}
+	}
+
+	// All helpers must build the same tree
+	counts := map[ValueType]int{'z': 0, 'y': -1}
+	for _, b := range data {
+		counts[ValueType(b)]++
+	}
+	fromReader, err := FromReader(iotest.OneByteReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Errorf("Got error: %v", err)
+	}
+	want := codeStrings(h.Build())
+	for i, root := range []*Node{FromBytes(data), fromReader, FromCounts(counts)} {
+		if got := codeStrings(root); got != want {
+			t.Errorf("[%d] Got: %s, want: %s", i, got, want)
+		}
+	}
+
+	// Empty input
+	if root := FromBytes(nil); root != nil {
+		t.Errorf("Got: %v, want: nil", root)
+	}
+	if root := FromCounts(map[ValueType]int{'a': 0}); root != nil {
+		t.Errorf("Got: %v, want: nil", root)
+	}
+	errTest := errors.New("test error")
+	if _, err := FromReader(io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errTest))); err != errTest {
+		t.Errorf("Got: %v, want: %v", err, errTest)
+	}
+}
+
+// codeStrings returns the codes of the leaves of a tree as a string, for comparison.
+func codeStrings(root *Node) string {
+	buf := &bytes.Buffer{}
+	for _, leaf := range Leaves(root) {
+		r, bits := leaf.Code()
+		buf.WriteString(string(rune(leaf.Value)) + ":" + formatCode(r, bits) + " ")
+	}
+	return buf.String()
+}
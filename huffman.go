@@ -5,7 +5,33 @@ Package huffman implements a Huffman entropy coding.
 https://en.wikipedia.org/wiki/Huffman_coding
 
 Use the Build() function to build a Huffman tree. Use the Print() function to print Huffman codes
-of all leaves of a tree (for verification).
+of all leaves of a tree (for verification). Use the Fprint() function to print a tree to an io.Writer
+as text, in the Graphviz DOT language (for visualization) or as JSON.
+
+Use the Canonical() or CanonicalTree() functions to get the canonical Huffman codes of a tree,
+which can be reconstructed from the code lengths alone using AssignCanonical().
+Use the FromLengths() function to rebuild the tree of canonical codes from (validated) code lengths,
+such as the ones found in DEFLATE or JPEG headers.
+
+Use the FromBytes(), FromReader() or FromCounts() functions to build a Huffman tree directly from data or value counts.
+A Histogram counts the occurrences of values, and histograms of multiple shards of data can be merged.
+
+Use the BuildTree() function to build a generic Huffman tree (of TreeNode) whose leaves carry values
+of an arbitrary type (such as strings), and LeafMap() and TreeNode.Decode() to encode / decode values.
+
+Use the BuildNary() function to build an n-ary Huffman tree (of NaryNode, up to 256-ary), whose codes consist of digits.
+
+Use the BuildLimited() function to build a Huffman tree whose codes are not longer than a given limit.
+
+Use the Stats() function to get the statistics of a Huffman tree (entropy, average code length, redundancy,
+code length range, Kraft sum), and EncodedBits() to get the encoded size of data having given value counts.
+
+Use the NewTable() function to create a Table from a Huffman tree, which provides fast encoding
+and lookup table based decoding (reading bits from a BitReader).
+
+Both Node (as the root of a tree) and Table implement encoding.BinaryMarshaler and json.Marshaler
+(and their unmarshaler counterparts). The binary form only holds the code lengths (canonical form),
+the JSON form holds the exact tree / codes.
 
 Example:
 
@@ -32,11 +58,7 @@ Output:
 */
 package huffman
 
-import (
-	"fmt"
-	"sort"
-	"strconv"
-)
+import "os"
 
 // ValueType is the type of the value stored in a Node.
 type ValueType int32
@@ -71,61 +93,59 @@ func (sn SortNodes) Less(i, j int) bool { return sn[i].Count < sn[j].Count }
 func (sn SortNodes) Swap(i, j int)      { sn[i], sn[j] = sn[j], sn[i] }
 
 // Build builds a Huffman tree from the specified leaves.
-// The content of the passed slice is modified, if this is unwanted, pass a copy.
+// The passed slice is not modified (only the Parent fields of the leaves are set).
+// Note: earlier versions sorted the slice in place by Node.Count; callers relying on that
+// must sort the leaves themselves, e.g. using sort.Stable(SortNodes(leaves)).
 // Guaranteed that the same input slice will result in the same Huffman tree.
+//
+// Build runs in O(n log n) time, and results in the same tree as BuildSorted would
+// after stable sorting the leaves by Node.Count.
 func Build(leaves []*Node) *Node {
-	// We sort once and use binary insertion later on
-	sort.Stable(SortNodes(leaves)) // Note: stable sort for deterministic output!
-
-	return BuildSorted(leaves)
+	return build(leaves, (*Node).count, joinNodes)
 }
 
 // BuildSorted builds a Huffman tree from the specified leaves which must be sorted by Node.Count.
-// The content of the passed slice is modified, if this is unwanted, pass a copy.
+// The passed slice is not modified (only the Parent fields of the leaves are set).
 // Guaranteed that the same input slice will result in the same Huffman tree.
+//
+// BuildSorted runs in O(n) time.
 func BuildSorted(leaves []*Node) *Node {
-	if len(leaves) == 0 {
-		return nil
-	}
+	return buildSorted(leaves, (*Node).count, joinNodes)
+}
 
-	for len(leaves) > 1 {
-		left, right := leaves[0], leaves[1]
-		parentCount := left.Count + right.Count
-		parent := &Node{Left: left, Right: right, Count: parentCount}
-		left.Parent = parent
-		right.Parent = parent
-
-		// Where to insert parent in order to remain sorted?
-		ls := leaves[2:]
-		idx := sort.Search(len(ls), func(i int) bool { return ls[i].Count >= parentCount })
-		idx += 2
-
-		// Insert
-		copy(leaves[1:], leaves[2:idx])
-		leaves[idx-1] = parent
-		leaves = leaves[1:]
-	}
+// count returns the count of the node.
+func (n *Node) count() int { return n.Count }
 
-	return leaves[0]
+// joinNodes creates the parent of 2 nodes.
+func joinNodes(left, right *Node) *Node {
+	parent := &Node{Left: left, Right: right, Count: left.Count + right.Count}
+	left.Parent = parent
+	right.Parent = parent
+	return parent
 }
 
-// Print traverses the Huffman tree and prints the values with their code in binary representation.
-// For debugging purposes.
-func Print(root *Node) {
-	// traverse traverses a subtree from the given node,
-	// using the prefix code leading to this node, having the number of bits specified.
-	var traverse func(n *Node, code uint64, bits byte)
+// Leaves returns the leaves of the Huffman tree, in left-to-right order.
+func Leaves(root *Node) (leaves []*Node) {
+	if root == nil {
+		return nil
+	}
 
-	traverse = func(n *Node, code uint64, bits byte) {
+	var traverse func(n *Node)
+	traverse = func(n *Node) {
 		if n.Left == nil {
-			// Leaf
-			fmt.Printf("'%c': %0"+strconv.Itoa(int(bits))+"b\n", n.Value, code)
+			leaves = append(leaves, n)
 			return
 		}
-		bits++
-		traverse(n.Left, code<<1, bits)
-		traverse(n.Right, code<<1+1, bits)
+		traverse(n.Left)
+		traverse(n.Right)
 	}
 
-	traverse(root, 0, 0)
+	traverse(root)
+	return
+}
+
+// Print traverses the Huffman tree and prints the values with their code in binary representation.
+// For debugging purposes. See Fprint for other formats and outputs.
+func Print(root *Node) {
+	Fprint(os.Stdout, root, FormatText)
 }
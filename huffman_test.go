@@ -1,7 +1,10 @@
 package huffman
 
 import (
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
 	"testing"
 )
 
@@ -81,3 +84,334 @@ func TestBuild2(t *testing.T) {
 		}
 	}
 }
+
+func TestCanonical(t *testing.T) {
+	leaves := []*Node{
+		{Value: ' ', Count: 20},
+		{Value: 'a', Count: 40},
+		{Value: 'l', Count: 7},
+		{Value: 'm', Count: 10},
+		{Value: 'f', Count: 8},
+		{Value: 't', Count: 15},
+	}
+	root := Build(leaves)
+	if s := fmt.Sprint(leaves[0].Value, leaves[5].Value); s != "32 116" {
+		t.Errorf("Build modified the slice, got: %s", s)
+	}
+
+	expected := []Code{
+		{Value: 'a', Code: 0x0, Bits: 1}, // 0
+		{Value: ' ', Code: 0x4, Bits: 3}, // 100
+		{Value: 'm', Code: 0x5, Bits: 3}, // 101
+		{Value: 't', Code: 0x6, Bits: 3}, // 110
+		{Value: 'f', Code: 0xe, Bits: 4}, // 1110
+		{Value: 'l', Code: 0xf, Bits: 4}, // 1111
+	}
+
+	for _, codes := range [][]Code{Canonical(leaves), CanonicalTree(root)} {
+		if len(codes) != len(expected) {
+			t.Fatalf("Got: %v, want: %v", codes, expected)
+		}
+		for i, exp := range expected {
+			if got := codes[i]; got != exp {
+				t.Errorf("Got: %v, want: %v", got, exp)
+			}
+		}
+	}
+
+	// Codes must be reconstructable from the lengths only:
+	lengths := make([]Code, len(expected))
+	for i, c := range expected {
+		lengths[len(lengths)-1-i] = Code{Value: c.Value, Bits: c.Bits}
+	}
+	AssignCanonical(lengths)
+	for i, exp := range expected {
+		if got := lengths[i]; got != exp {
+			t.Errorf("Got: %v, want: %v", got, exp)
+		}
+	}
+
+	// Zero length codes (absent values) are skipped:
+	lengths = []Code{{Value: 3, Bits: 1}, {Value: 1, Bits: 0}, {Value: 2, Bits: 1}}
+	AssignCanonical(lengths)
+	expected = []Code{{Value: 1, Code: 0, Bits: 0}, {Value: 2, Code: 0, Bits: 1}, {Value: 3, Code: 1, Bits: 1}}
+	for i, exp := range expected {
+		if got := lengths[i]; got != exp {
+			t.Errorf("Got: %v, want: %v", got, exp)
+		}
+	}
+
+	if codes := CanonicalTree(nil); len(codes) != 0 {
+		t.Errorf("Got: %v, want: empty", codes)
+	}
+}
+
+// cost returns the total number of bits needed to encode the leaves.
+func cost(leaves []*Node) (total int) {
+	for _, leaf := range leaves {
+		_, bits := leaf.Code()
+		total += leaf.Count * int(bits)
+	}
+	return
+}
+
+func TestFromLengths(t *testing.T) {
+	// DEFLATE RFC 1951 example: ABCDEFGH with lengths 3, 3, 3, 3, 3, 2, 4, 4
+	codes := []Code{
+		{Value: 'A', Bits: 3}, {Value: 'B', Bits: 3}, {Value: 'C', Bits: 3}, {Value: 'D', Bits: 3},
+		{Value: 'E', Bits: 3}, {Value: 'F', Bits: 2}, {Value: 'G', Bits: 4}, {Value: 'H', Bits: 4},
+		{Value: 'X', Bits: 0}, // Not present
+	}
+	root, err := FromLengths(codes)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	expected := map[ValueType]string{
+		'A': "010", 'B': "011", 'C': "100", 'D': "101", 'E': "110", 'F': "00", 'G': "1110", 'H': "1111",
+	}
+	leaves := Leaves(root)
+	if len(leaves) != len(expected) {
+		t.Errorf("Got: %d leaves, want: %d", len(leaves), len(expected))
+	}
+	for _, leaf := range leaves {
+		if got := formatCode(leaf.Code()); got != expected[leaf.Value] {
+			t.Errorf("Got: %s, want: %s (value: '%c')", got, expected[leaf.Value], leaf.Value)
+		}
+	}
+
+	// Single leaf
+	root, err = FromLengths([]Code{{Value: 'a'}})
+	if err != nil || root.Left != nil || root.Value != 'a' {
+		t.Errorf("Got: %v, %v, want: single leaf", root, err)
+	}
+
+	cases := []struct {
+		name  string
+		codes []Code
+		err   error
+		msg   string
+	}{
+		{"empty", nil, ErrIncomplete, "huffman: incomplete code lengths: no codes"},
+		{"zeros", []Code{{Value: 1}, {Value: 2}}, ErrIncomplete, ""},
+		{"single-1", []Code{{Value: 1, Bits: 1}}, ErrIncomplete, "huffman: incomplete code lengths: 1 unused codes of length 1"},
+		{"over", []Code{{Value: 1, Bits: 1}, {Value: 2, Bits: 2}, {Value: 3, Bits: 2}, {Value: 4, Bits: 2}},
+			ErrOversubscribed, "huffman: over-subscribed code lengths: 3 codes of length 2, only 2 available"},
+		{"over-1", []Code{{Value: 1, Bits: 1}, {Value: 2, Bits: 1}, {Value: 3, Bits: 1}}, ErrOversubscribed, ""},
+		{"incomplete", []Code{{Value: 1, Bits: 1}, {Value: 2, Bits: 3}, {Value: 3, Bits: 3}}, ErrIncomplete,
+			"huffman: incomplete code lengths: 2 unused codes of length 3"},
+		{"incomplete-long", []Code{{Value: 1, Bits: 1}, {Value: 2, Bits: 64}}, ErrIncomplete, ""},
+		{"too long", []Code{{Value: 1, Bits: 1}, {Value: 2, Bits: 65}}, ErrCodeTooLong, ""},
+		{"duplicate", []Code{{Value: 1, Bits: 1}, {Value: 1, Bits: 1}}, ErrDuplicateValue, ""},
+	}
+	for _, c := range cases {
+		root, err := FromLengths(c.codes)
+		if root != nil || !errors.Is(err, c.err) || c.msg != "" && err.Error() != c.msg {
+			t.Errorf("[%s] Got: %v, %v, want: %v (%s)", c.name, root, err, c.err, c.msg)
+		}
+	}
+
+	// Canonical codes of built trees must be rebuilt
+	for i := 0; i < 100; i++ {
+		leaves := make([]*Node, rand.Intn(100)+1)
+		for j := range leaves {
+			leaves[j] = &Node{Value: ValueType(j), Count: rand.Intn(1000)}
+		}
+		codes := CanonicalTree(Build(leaves))
+		root, err := FromLengths(codes)
+		if err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+		if got, want := fmt.Sprint(CanonicalTree(root)), fmt.Sprint(codes); got != want {
+			t.Errorf("Got: %s, want: %s", got, want)
+		}
+	}
+}
+
+func TestBuildLimited(t *testing.T) {
+	if root, err := BuildLimited(nil, 8); root != nil || err != nil {
+		t.Errorf("Got: %v, %v, want: nil, nil", root, err)
+	}
+
+	single := &Node{Value: 'a', Count: 3}
+	if root, err := BuildLimited([]*Node{single}, 8); root != single || err != nil {
+		t.Errorf("Got: %v, %v, want: %v, nil", root, err, single)
+	}
+
+	newFib := func(n int) []*Node {
+		leaves := make([]*Node, n)
+		a, b := 1, 1
+		for i := range leaves {
+			leaves[i] = &Node{Value: ValueType('a' + i), Count: a}
+			a, b = b, a+b
+		}
+		return leaves
+	}
+
+	if _, err := BuildLimited(newFib(9), 3); err != ErrMaxBits {
+		t.Errorf("Got: %v, want: %v", err, ErrMaxBits)
+	}
+
+	// Passed slice must not be modified
+	leaves := newFib(5)
+	leaves[0], leaves[4] = leaves[4], leaves[0]
+	if _, err := BuildLimited(leaves, 8); err != nil || leaves[0].Value != 'e' || leaves[4].Value != 'a' {
+		t.Errorf("BuildLimited modified the slice, got: %c, %c, %v", leaves[0].Value, leaves[4].Value, err)
+	}
+
+	cases := []struct {
+		n       int  // Number of leaves
+		maxBits byte // Max code length
+	}{
+		{2, 1},
+		{10, 64},
+		{10, 9},
+		{10, 4},
+		{20, 64},
+		{20, 5},
+		{8, 3},
+	}
+
+	for _, c := range cases {
+		leaves := newFib(c.n)
+		root, err := BuildLimited(leaves, c.maxBits)
+		if err != nil {
+			t.Errorf("[n=%d, maxBits=%d] Got error: %v", c.n, c.maxBits, err)
+			continue
+		}
+
+		kraft := 0.0
+		for _, leaf := range leaves {
+			_, bits := leaf.Code()
+			if bits > c.maxBits {
+				t.Errorf("[n=%d, maxBits=%d] Got code length: %d", c.n, c.maxBits, bits)
+			}
+			kraft += 1 / float64(uint64(1)<<bits)
+		}
+		if kraft != 1 {
+			t.Errorf("[n=%d, maxBits=%d] Got Kraft sum: %v, want: 1", c.n, c.maxBits, kraft)
+		}
+
+		// Codes must be canonical
+		for _, code := range CanonicalTree(root) {
+			for _, leaf := range leaves {
+				if leaf.Value != code.Value {
+					continue
+				}
+				if r, bits := leaf.Code(); r != code.Code || bits != code.Bits {
+					t.Errorf("[n=%d, maxBits=%d] Got: %b, want: %b", c.n, c.maxBits, r, code.Code)
+				}
+			}
+		}
+
+		// If the constraint is not binding, result must be as good as the unconstrained Huffman code
+		leaves2 := newFib(c.n)
+		Build(leaves2)
+		if got, unlimited := cost(leaves), cost(leaves2); got < unlimited {
+			t.Errorf("[n=%d, maxBits=%d] Got cost: %d, which is better than optimal: %d", c.n, c.maxBits, got, unlimited)
+		} else if int(c.maxBits) >= c.n-1 && got != unlimited {
+			t.Errorf("[n=%d, maxBits=%d] Got cost: %d, want: %d", c.n, c.maxBits, got, unlimited)
+		}
+	}
+}
+
+func TestBuildLimitedCost(t *testing.T) {
+	// Unconstrained Huffman code would be 4 bits long for 'a' and 'b'
+	leaves := []*Node{
+		{Value: 'a', Count: 1},
+		{Value: 'b', Count: 1},
+		{Value: 'c', Count: 5},
+		{Value: 'd', Count: 7},
+		{Value: 'e', Count: 10},
+		{Value: 'f', Count: 14},
+	}
+	if _, err := BuildLimited(leaves, 3); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	// Optimal lengths: a, b, c, d: 3 bits, e, f: 2 bits
+	if got, exp := cost(leaves), 3*(1+1+5+7)+2*(10+14); got != exp {
+		t.Errorf("Got cost: %d, want: %d", got, exp)
+	}
+}
+
+// buildSortedInsertion is the reference implementation of BuildSorted:
+// each parent is inserted into the sorted list of the remaining nodes using binary search.
+func buildSortedInsertion(leaves []*Node) *Node {
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	for len(leaves) > 1 {
+		left, right := leaves[0], leaves[1]
+		parentCount := left.Count + right.Count
+		parent := &Node{Left: left, Right: right, Count: parentCount}
+		left.Parent = parent
+		right.Parent = parent
+
+		ls := leaves[2:]
+		idx := sort.Search(len(ls), func(i int) bool { return ls[i].Count >= parentCount })
+		idx += 2
+
+		copy(leaves[1:], leaves[2:idx])
+		leaves[idx-1] = parent
+		leaves = leaves[1:]
+	}
+
+	return leaves[0]
+}
+
+// treeString returns the structure of a tree as a string, for comparison.
+func treeString(n *Node) string {
+	if n.Left == nil {
+		return fmt.Sprintf("%d:%d", n.Value, n.Count)
+	}
+	return "(" + treeString(n.Left) + " " + treeString(n.Right) + ")"
+}
+
+func TestBuildSameAsInsertion(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		n := rand.Intn(200) + 1
+		maxCount := rand.Intn(20) + 1 // Small counts for lots of ties
+		if i%10 == 0 {
+			maxCount = 1 << 20
+		}
+		leaves := make([]*Node, n)
+		for j := range leaves {
+			leaves[j] = &Node{Value: ValueType(j), Count: rand.Intn(maxCount)}
+		}
+
+		// newLeaves returns a copy of the leaves with new nodes.
+		newLeaves := func() []*Node {
+			ls := make([]*Node, n)
+			for j, leaf := range leaves {
+				ls[j] = &Node{Value: leaf.Value, Count: leaf.Count}
+			}
+			return ls
+		}
+
+		ref := newLeaves()
+		sort.Stable(SortNodes(ref))
+		want := treeString(buildSortedInsertion(ref))
+
+		if got := treeString(Build(newLeaves())); got != want {
+			t.Fatalf("Build: got: %s, want: %s", got, want)
+		}
+		sorted := newLeaves()
+		sort.Stable(SortNodes(sorted))
+		if got := treeString(BuildSorted(sorted)); got != want {
+			t.Fatalf("BuildSorted: got: %s, want: %s", got, want)
+		}
+	}
+}
+
+func BenchmarkBuildSorted(b *testing.B) {
+	leaves := make([]*Node, 100000)
+	for i := range leaves {
+		leaves[i] = &Node{Value: ValueType(i), Count: i / 3}
+	}
+	ls := make([]*Node, len(leaves))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		copy(ls, leaves)
+		BuildSorted(ls)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+
+Block mode implementation: framing of independently decodable blocks.
+
+*/
+
+package hufio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
+)
+
+// blockResult is the result of encoding or decoding a block.
+type blockResult struct {
+	values []huffman.ValueType // Values of the block (input of encoding, output of decoding)
+	frame  []byte              // Encoded frame
+	err    error               // Error
+}
+
+// encodeBlock encodes a block of data as an independent segment, and returns its frame:
+// the size of the encoded segment (uvarint) followed by the encoded segment.
+func encodeBlock(data []huffman.ValueType, o *Options) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.Write(make([]byte, binary.MaxVarintLen64)) // Reserve space for the size
+	bw := bitio.NewWriter(buf)
+
+	e := newEncoder(bw, o)
+	for _, v := range data {
+		if err := e.writeValue(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.close(); err != nil {
+		return nil, err
+	}
+	if _, err := bw.Align(); err != nil {
+		return nil, err
+	}
+
+	frame := buf.Bytes()
+	size := len(frame) - binary.MaxVarintLen64
+	var sizeBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(sizeBuf[:], uint64(size))
+	frame = frame[binary.MaxVarintLen64-n:]
+	copy(frame, sizeBuf[:n])
+	return frame, nil
+}
+
+// writeEndFrame writes the frame marking the end of blocks (a frame with zero size).
+//
+// If Options.Checksum is set, it is followed by the frames trailer: the number of frames and the total size
+// of their encoded segments (uvarint encoded). The checksum of each block only covers its own data, the trailer
+// protects the framing: a frame size corrupted to zero would otherwise silently end the stream.
+func writeEndFrame(bw *bitio.Writer, o *Options, frames, size uint64) error {
+	end := []byte{0}
+	if o.Checksum {
+		end = appendUvarint(appendUvarint(end, frames), size)
+	}
+	_, err := bw.Write(end)
+	return err
+}
+
+// frameReader reads the frames of a stream in block mode, and verifies the frames trailer.
+type frameReader struct {
+	br     *huffman.BitReader
+	o      *Options
+	frames uint64 // Number of frames read
+	size   uint64 // Total size of the encoded segments read
+}
+
+// next reads the next frame, and returns the encoded segment.
+// io.EOF is returned if the end frame is read (and the frames trailer is verified if Options.Checksum is set).
+func (fr *frameReader) next() (segment []byte, err error) {
+	segment, err = readFrame(fr.br, fr.o)
+	switch {
+	case err == nil:
+		fr.frames++
+		fr.size += uint64(len(segment))
+	case err == io.EOF && fr.o.Checksum:
+		frames, err2 := binary.ReadUvarint(fr.br)
+		if err2 != nil {
+			return nil, unexpectedEOF(err2, fr.o)
+		}
+		size, err2 := binary.ReadUvarint(fr.br)
+		if err2 != nil {
+			return nil, unexpectedEOF(err2, fr.o)
+		}
+		if frames != fr.frames || size != fr.size {
+			return nil, ErrCorrupt // Frames lost or framing corrupted
+		}
+	}
+	return
+}
+
+// frameChunkSize is the initial buffer size for reading frames.
+const frameChunkSize = 64 * 1024
+
+// maxFrameSize returns the max size of a valid encoded segment in block mode.
+// A symbol is encoded using at most 64 bits (plus Options.LiteralBits if it is a new symbol).
+func maxFrameSize(o *Options) int64 {
+	return int64(8+(o.LiteralBits+7)/8)*int64(o.BlockSize) + maxTableSize(o) + 64
+}
+
+// readFrame reads the next frame, and returns the encoded segment.
+// io.EOF is returned if the end frame is read.
+func readFrame(br *huffman.BitReader, o *Options) (segment []byte, err error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		// End frame is always written, so the stream is truncated
+		return nil, unexpectedEOF(err, o)
+	}
+	if size == 0 {
+		return nil, io.EOF
+	}
+	if size > uint64(maxFrameSize(o)) {
+		return nil, ErrCorrupt
+	}
+
+	// Size is not trusted, the buffer grows as data is read (so a corrupted size can't allocate a huge buffer):
+	buf := bytes.NewBuffer(make([]byte, 0, minInt64(int64(size), frameChunkSize)))
+	if _, err = io.CopyN(buf, br, int64(size)); err != nil {
+		return nil, unexpectedEOF(err, o)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBlock decodes an encoded segment of a block.
+func decodeBlock(segment []byte, o *Options) (data []huffman.ValueType, err error) {
+	d := newDecoder(huffman.NewBitReader(bytes.NewReader(segment)), o)
+	// BlockSize may come from the stream header, capacity is limited by the max number of values in the segment:
+	data = make([]huffman.ValueType, 0, minInt64(int64(o.BlockSize), int64(len(segment))*8))
+	for {
+		var v huffman.ValueType
+		if v, err = d.readValue(); err != nil {
+			break
+		}
+		if len(data) == o.BlockSize {
+			return nil, ErrCorrupt
+		}
+		data = append(data, v)
+	}
+
+	if err == errSync {
+		return nil, ErrCorrupt // Blocks never contain sync markers
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+	if !d.eof || len(data) == 0 {
+		return nil, ErrCorrupt // The segment is complete, it must end with eofValue
+	}
+	return data, nil
+}
+
+// unexpectedEOF returns the error to report if the stream ends unexpectedly:
+// io.EOF is turned into io.ErrUnexpectedEOF, or ErrCorrupt if Options.Checksum is set.
+func unexpectedEOF(err error, o *Options) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if o.Checksum {
+			return ErrCorrupt
+		}
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// minInt64 returns the smaller of a and b.
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
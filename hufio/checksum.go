@@ -0,0 +1,74 @@
+/*
+
+Integrity checksum implementation.
+
+*/
+
+package hufio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
+)
+
+var (
+	// ErrChecksum is returned by Reader if the checksum or the length of the decoded data
+	// does not match the ones written by the Writer.
+	ErrChecksum = errors.New("hufio: checksum error")
+
+	// ErrCorrupt is returned by Reader if the stream is detected to be corrupted or truncated.
+	ErrCorrupt = errors.New("hufio: corrupted stream")
+)
+
+// updateCRC updates the CRC-32 (IEEE) checksum with the byte b.
+func updateCRC(crc uint32, b byte) uint32 {
+	crc = ^crc
+	crc = crc32.IEEETable[byte(crc)^b] ^ crc>>8
+	return ^crc
+}
+
+// updateCRCValue updates the CRC-32 (IEEE) checksum with the value v:
+// with its low (Options.LiteralBits+7)/8 bytes, in little endian byte order.
+// This is the same as updateCRC() for the byte alphabet.
+func updateCRCValue(crc uint32, v huffman.ValueType, o *Options) uint32 {
+	for i := 0; i < (o.LiteralBits+7)/8; i++ {
+		crc = updateCRC(crc, byte(v>>(8*i)))
+	}
+	return crc
+}
+
+// writeTrailer writes the trailer holding the checksum and the length of the uncompressed data.
+//
+// The trailer starts at a byte boundary, and it is the CRC-32 (IEEE) checksum (4 bytes, big endian)
+// followed by the uvarint encoded length.
+func writeTrailer(bw *bitio.Writer, crc uint32, n uint64) (err error) {
+	if _, err = bw.Align(); err != nil {
+		return
+	}
+	trailer := make([]byte, 4, 4+binary.MaxVarintLen64)
+	binary.BigEndian.PutUint32(trailer, crc)
+	_, err = bw.Write(appendUvarint(trailer, n))
+	return
+}
+
+// readTrailer reads the trailer written by writeTrailer(), and verifies the checksum and the length.
+func readTrailer(br *huffman.BitReader, crc uint32, n uint64) error {
+	br.Align()
+	var buf [4]byte
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
+		return ErrCorrupt
+	}
+	n2, err := binary.ReadUvarint(br)
+	if err != nil {
+		return ErrCorrupt
+	}
+	if binary.BigEndian.Uint32(buf[:]) != crc || n2 != n {
+		return ErrChecksum
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+
+Preset dictionary (pre-trained symbol frequencies) implementation.
+
+*/
+
+package hufio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"sort"
+
+	"github.com/icza/huffman"
+)
+
+const (
+	// DefaultDictWeight is the default weight (the sum of counts) of dictionaries created by TrainDict().
+	DefaultDictWeight = 1024
+
+	// maxDictCount is the max count of a value in a dictionary.
+	maxDictCount = 1<<31 - 1
+
+	// dictVersion is the version of the binary form of dictionaries.
+	dictVersion = 1
+)
+
+var (
+	// ErrDict is returned by Reader if the stream was written using a dictionary
+	// which is not available (Options.Dict of the Reader is nil or it is a different dictionary).
+	ErrDict = errors.New("hufio: dictionary mismatch")
+
+	// ErrInvalidDict is returned if unmarshaling invalid binary data as a dictionary is attempted.
+	ErrInvalidDict = errors.New("hufio: invalid dictionary")
+)
+
+// Dict is a preset dictionary: a pre-trained frequency table of symbols which is used to seed
+// the symbol table in adaptive modes (see Options.Dict), so short data having a known distribution
+// compresses well right from the start (symbols of the dictionary are known, they don't have to be
+// transmitted as new symbols).
+//
+// The counts of the dictionary are added to the counts of the symbols in the window (they never shift out),
+// so the weight of the dictionary (the sum of its counts) relative to the window size determines
+// how fast the symbol table adapts to the actual data.
+//
+// Dict must not be modified after creation, but it is safe for concurrent use.
+type Dict struct {
+	leaves []huffman.Node // Values and their counts, sorted by count descendant, then by value
+	id     uint32         // ID of the dictionary, the checksum (CRC-32) of its binary form
+}
+
+// NewDict creates a new Dict from the specified value counts.
+// Values having non-positive counts are ignored, counts greater than 1<<31-1 are treated as 1<<31-1.
+// ErrValueRange is returned if a value is negative or not less than 1<<MaxLiteralBits.
+func NewDict(counts map[huffman.ValueType]int) (*Dict, error) {
+	leaves := make([]huffman.Node, 0, len(counts))
+	for v, count := range counts {
+		if v < 0 || v >= 1<<MaxLiteralBits {
+			return nil, ErrValueRange
+		}
+		if count > maxDictCount {
+			count = maxDictCount
+		}
+		if count > 0 {
+			leaves = append(leaves, huffman.Node{Value: v, Count: count})
+		}
+	}
+	return newDict(leaves), nil
+}
+
+// TrainDict creates a new Dict from the value counts of sample data collected in a histogram
+// (e.g. by writing samples to it, see huffman.Histogram.Write()).
+//
+// Counts are scaled down so that their sum is (about) weight, but values occurring
+// in the samples remain in the dictionary. 0 (or a negative value) means to use DefaultDictWeight.
+// ErrValueRange is returned if a value is negative or not less than 1<<MaxLiteralBits.
+func TrainDict(h *huffman.Histogram, weight int) (*Dict, error) {
+	if weight <= 0 {
+		weight = DefaultDictWeight
+	}
+
+	hleaves := h.Leaves()
+	var total float64
+	for _, l := range hleaves {
+		total += float64(l.Count)
+	}
+	scale := 1.0
+	if total > float64(weight) {
+		scale = float64(weight) / total
+	}
+
+	counts := make(map[huffman.ValueType]int, len(hleaves))
+	for _, l := range hleaves {
+		count := int(float64(l.Count)*scale + 0.5)
+		if count < 1 {
+			count = 1
+		}
+		counts[l.Value] = count
+	}
+	return NewDict(counts)
+}
+
+// newDict creates a new Dict from the leaves (which are sorted in place).
+func newDict(leaves []huffman.Node) *Dict {
+	sort.Slice(leaves, func(i, j int) bool {
+		if leaves[i].Count != leaves[j].Count {
+			return leaves[i].Count > leaves[j].Count
+		}
+		return leaves[i].Value < leaves[j].Value
+	})
+	d := &Dict{leaves: leaves}
+	data, _ := d.MarshalBinary()
+	d.id = crc32.ChecksumIEEE(data)
+	return d
+}
+
+// ID returns the ID of the dictionary, which is the checksum (CRC-32) of its binary form.
+// If Options.Header is true, the ID is written to the stream header, so Reader can detect
+// if it uses a different dictionary.
+func (d *Dict) ID() uint32 {
+	return d.id
+}
+
+// Counts returns the counts of the values of the dictionary.
+func (d *Dict) Counts() map[huffman.ValueType]int {
+	counts := make(map[huffman.ValueType]int, len(d.leaves))
+	for _, l := range d.leaves {
+		counts[l.Value] = l.Count
+	}
+	return counts
+}
+
+// seed returns the leaves of the dictionary whose values are in the alphabet specified by the options,
+// sorted by count descendant, then by value.
+func (d *Dict) seed(o *Options) []huffman.Node {
+	if o.LiteralBits >= MaxLiteralBits {
+		return d.leaves
+	}
+	leaves := make([]huffman.Node, 0, len(d.leaves))
+	for _, l := range d.leaves {
+		if validValue(l.Value, o) {
+			leaves = append(leaves, l)
+		}
+	}
+	return leaves
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The binary form is the format version, followed by the number of values, followed by the values
+// (sorted) as the difference to the previous value and their counts, all uvarint encoded.
+func (d *Dict) MarshalBinary() ([]byte, error) {
+	sorted := append([]huffman.Node(nil), d.leaves...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+
+	data := appendUvarint([]byte{dictVersion}, uint64(len(sorted)))
+	var prev huffman.ValueType
+	for _, l := range sorted {
+		data = appendUvarint(data, uint64(l.Value-prev))
+		data = appendUvarint(data, uint64(l.Count))
+		prev = l.Value
+	}
+	return data, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// ErrInvalidDict is returned if data is not the binary form of a dictionary.
+func (d *Dict) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] != dictVersion {
+		return ErrInvalidDict
+	}
+	data = data[1:]
+
+	count, n := binary.Uvarint(data)
+	// Each value takes at least 2 bytes:
+	if n <= 0 || count > uint64(len(data)-n)/2 {
+		return ErrInvalidDict
+	}
+	data = data[n:]
+
+	leaves := make([]huffman.Node, count)
+	var value uint64
+	for i := range leaves {
+		diff, n := binary.Uvarint(data)
+		if n <= 0 || i > 0 && diff == 0 {
+			return ErrInvalidDict
+		}
+		data = data[n:]
+		c, n := binary.Uvarint(data)
+		if n <= 0 || c == 0 || c > maxDictCount {
+			return ErrInvalidDict
+		}
+		data = data[n:]
+		if value += diff; diff >= 1<<MaxLiteralBits || value >= 1<<MaxLiteralBits {
+			return ErrInvalidDict
+		}
+		leaves[i] = huffman.Node{Value: huffman.ValueType(value), Count: int(c)}
+	}
+	if len(data) > 0 {
+		return ErrInvalidDict
+	}
+
+	*d = *newDict(leaves)
+	return nil
+}
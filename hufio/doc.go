@@ -10,6 +10,45 @@ The implementation uses a sliding window which is used to manage the symbol tabl
 The sliding window is optional, that is, if no window is used, the symbol table is calculated based on
 all previously encountered symbols.
 
+By default the Huffman tree is rebuilt after each symbol. The FGK mode (see ModeFGK) implements
+the FGK adaptive Huffman algorithm which updates the tree in place, which is much faster.
+
+Alternatively the static (two-pass) mode may be used (see ModeStatic), in which case the Writer
+buffers all data, and when closed, it writes a canonical code table followed by the data encoded using this fixed code.
+The Reader decodes such data using multi-level lookup tables, which is much faster than walking the tree bit by bit.
+Adaptive modes can't use lookup tables (the tree changes after each symbol), they are always decoded bit by bit,
+also in block mode: use the static mode with Options.BlockSize when decoding speed matters (e.g. for archived data).
+
+By default Options are not transmitted, the Reader must use the same Options as the Writer did.
+If Options.Header is set, the Writer writes a stream header describing the Options,
+and the Reader reads the Options from it.
+
+If Options.Checksum is set, the Writer appends a checksum and the length of the data to the stream,
+which the Reader verifies, reporting ErrChecksum or ErrCorrupt if the stream is corrupted or truncated.
+
+If Options.BlockSize is set, data is split into blocks which are encoded independently (each starting
+with a fresh symbol table) in size prefixed frames, so data of intact blocks can be recovered even if the stream is corrupted.
+Blocks may be encoded and decoded concurrently on multiple goroutines, see Options.Concurrency.
+
+If Options.Seekable is set, the Writer appends a block index to the stream (block mode is implied).
+A SeekableReader provides random access to the data of such streams (it implements io.Reader, io.Seeker and io.ReaderAt),
+only reading and decoding the blocks containing the requested data.
+
+SymbolWriter and SymbolReader code symbols of arbitrary alphabets (such as 16-bit tokens or word IDs)
+instead of bytes. The alphabet is specified by Options.LiteralBits: new symbols are transmitted using this many bits.
+
+Writer.Flush writes a sync point, so a Reader on the other end of a connection can decode all data written so far
+without ending the stream (Reader.Read returns the available data at sync points). Static mode can only be flushed in block mode.
+
+Writer.Reset and Reader.Reset reinitialize a Writer / Reader to process a new stream, reusing the allocated buffers,
+so they can be pooled (e.g. using sync.Pool) when many small streams are processed.
+
+Short data compresses poorly in adaptive modes, as the symbol table starts empty and each new symbol is transmitted
+with an escape code. If Options.Dict is set, the symbol table is seeded with a preset dictionary (a pre-trained
+frequency table of symbols), which the Writer and the Reader must both use. Use TrainDict to create a Dict
+from the histogram of sample data, or NewDict to create one from value counts. Dict can be serialized,
+and its ID is written to the stream header (if enabled), so the Reader can detect a dictionary mismatch (ErrDict).
+
 Writer + Reader example:
 
 	buf := &bytes.Buffer{}
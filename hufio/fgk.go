@@ -0,0 +1,263 @@
+/*
+
+FGK adaptive Huffman coding implementation.
+
+*/
+
+package hufio
+
+import (
+	"sort"
+
+	"github.com/icza/huffman"
+)
+
+// fgkNode is a node of the FGK Huffman tree.
+type fgkNode struct {
+	parent, left, right *fgkNode
+	weight              int               // Weight (count) of the node
+	value               huffman.ValueType // Value, set if this is a leaf
+	order               int               // Index of the node in fgk.nodes
+}
+
+// fgk is an adaptive Huffman model implementing the FGK (Faller-Gallager-Knuth) algorithm:
+// the Huffman tree is updated in place after each symbol, maintaining the sibling property.
+//
+// The sibling property: nodes can be listed in order of non-decreasing weight so that
+// siblings are adjacent (2j and 2j+1) and each node precedes its parent.
+//
+// newValue and eofValue have a constant weight of 1, and the weight of all other leaves is positive:
+// if it drops to zero (symbol shifting out of the window), the leaf is removed.
+//
+// fgk implements model.
+type fgk struct {
+	nodes    []*fgkNode                     // Nodes in the order of the sibling property, root is the last
+	root     *fgkNode                       // Root of the Huffman tree
+	valueMap map[huffman.ValueType]*fgkNode // Map from value to leaf
+	win      *win                           // The window buffer, nil if no window buffer is used
+	dict     []huffman.Node                 // Leaves of the dictionary seeding the tree (see Options.Dict)
+}
+
+// newFGK creates a new fgk.
+func newFGK(o *Options) *fgk {
+	m := &fgk{
+		nodes:    make([]*fgkNode, 0, 2*byteValues-1),
+		valueMap: make(map[huffman.ValueType]*fgkNode, byteValues),
+	}
+	if o.WinSize > 0 {
+		m.win = newWin(o.WinSize)
+	}
+	if o.Dict != nil {
+		m.dict = o.Dict.seed(o)
+	}
+
+	m.reset()
+
+	return m
+}
+
+// reset resets the Huffman tree to its initial state, keeping the allocated buffers.
+//
+// The initial tree is the Huffman tree of 2 leaves (newValue and eofValue) with weight=1,
+// and the leaves of the dictionary (if any). Nodes are ordered as they are taken
+// by the Huffman algorithm, which satisfies the sibling property.
+func (m *fgk) reset() {
+	for v := range m.valueMap {
+		delete(m.valueMap, v)
+	}
+
+	// Leaves in ascending order of weight (the dictionary is sorted by count descendant):
+	leaves := make([]*fgkNode, 0, len(m.dict)+extraValues)
+	leaves = append(leaves, &fgkNode{weight: 1, value: newValue}, &fgkNode{weight: 1, value: eofValue})
+	for i := len(m.dict) - 1; i >= 0; i-- {
+		leaves = append(leaves, &fgkNode{weight: m.dict[i].Count, value: m.dict[i].Value})
+	}
+	for _, n := range leaves {
+		m.valueMap[n.value] = n
+	}
+
+	// Two-queue Huffman algorithm:
+	m.nodes = m.nodes[:0]
+	parents := make([]*fgkNode, 0, len(leaves)-1)
+	// take takes the node with the lowest weight.
+	take := func() (n *fgkNode) {
+		if len(parents) > 0 && (len(leaves) == 0 || parents[0].weight < leaves[0].weight) {
+			n, parents = parents[0], parents[1:]
+		} else {
+			n, leaves = leaves[0], leaves[1:]
+		}
+		n.order = len(m.nodes)
+		m.nodes = append(m.nodes, n)
+		return
+	}
+	for len(leaves)+len(parents) > 1 {
+		left, right := take(), take()
+		parent := &fgkNode{left: left, right: right, weight: left.weight + right.weight}
+		left.parent, right.parent = parent, parent
+		parents = append(parents, parent)
+	}
+	m.root = take()
+
+	if m.win != nil {
+		m.win.reset()
+	}
+}
+
+// code returns the Huffman code of the specified value, ok is false if the value is unknown.
+func (m *fgk) code(value huffman.ValueType) (r uint64, bits byte, ok bool) {
+	n := m.valueMap[value]
+	if n == nil {
+		return
+	}
+	for parent := n.parent; parent != nil; n, parent = parent, parent.parent {
+		if parent.right == n { // bit 1
+			r |= 1 << bits
+		} // else bit 0 => nothing to do with r
+		bits++
+	}
+	return r, bits, true
+}
+
+// decode reads a Huffman code and returns the value it denotes.
+func (m *fgk) decode(br *huffman.BitReader) (value huffman.ValueType, err error) {
+	n := m.root
+	for n.left != nil { // read until we reach a leaf
+		var right bool
+		if right, err = br.ReadBool(); err != nil {
+			return
+		} else if right {
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return n.value, nil
+}
+
+// add updates the Huffman tree with an occurrence of the specified value.
+func (m *fgk) add(value huffman.ValueType) {
+	n := m.valueMap[value]
+	if n == nil {
+		n = m.insert(value)
+	}
+	m.increment(n)
+
+	if m.win == nil {
+		return
+	}
+	if out, ok := m.win.leaving(); ok {
+		n := m.valueMap[out]
+		m.decrement(n)
+		if n.weight == 0 {
+			m.remove(n)
+		}
+	}
+	m.win.store(value)
+}
+
+// insert inserts a new leaf with zero weight for the specified value, and returns it.
+//
+// The node with the lowest order is replaced by a new internal node whose children are
+// the new leaf and the replaced node.
+func (m *fgk) insert(value huffman.ValueType) *fgkNode {
+	old := m.nodes[0]
+	leaf := &fgkNode{value: value}
+	parent := &fgkNode{parent: old.parent, left: old, right: leaf, weight: old.weight}
+	if old.parent.left == old {
+		old.parent.left = parent
+	} else {
+		old.parent.right = parent
+	}
+	old.parent, leaf.parent = parent, parent
+
+	// New order: leaf, old, parent (in place of old), rest...
+	m.nodes = append(m.nodes, nil, nil)
+	copy(m.nodes[3:], m.nodes[1:])
+	m.nodes[0], m.nodes[1], m.nodes[2] = leaf, old, parent
+	for i, n := range m.nodes {
+		n.order = i
+	}
+
+	m.valueMap[value] = leaf
+	return leaf
+}
+
+// remove removes the leaf having zero weight.
+// The lowest ordered nodes are the leaf and its sibling: they are removed,
+// and the sibling takes the place of the parent.
+func (m *fgk) remove(leaf *fgkNode) {
+	parent := leaf.parent
+	sibling := parent.left
+	if sibling == leaf {
+		sibling = parent.right
+	}
+
+	sibling.parent = parent.parent
+	if parent.parent == nil {
+		m.root = sibling
+	} else if parent.parent.left == parent {
+		parent.parent.left = sibling
+	} else {
+		parent.parent.right = sibling
+	}
+
+	m.nodes[parent.order] = sibling
+	m.nodes = append(m.nodes[:0], m.nodes[2:]...)
+	for i, n := range m.nodes {
+		n.order = i
+	}
+
+	delete(m.valueMap, leaf.value)
+}
+
+// increment increments the weight of the leaf (and its ancestors).
+// Before incrementing the weight of a node, it is swapped with the highest ordered node having the same weight.
+func (m *fgk) increment(n *fgkNode) {
+	nodes := m.nodes
+	for ; n != nil; n = n.parent {
+		w := n.weight
+		leader := nodes[sort.Search(len(nodes), func(i int) bool { return nodes[i].weight > w })-1]
+		if leader != n && leader != n.parent {
+			m.swap(n, leader)
+		}
+		n.weight++
+	}
+}
+
+// decrement decrements the weight of the leaf (and its ancestors).
+// Before decrementing the weight of a node, it is swapped with the lowest ordered node having the same weight.
+func (m *fgk) decrement(n *fgkNode) {
+	nodes := m.nodes
+	for ; n != nil; n = n.parent {
+		w := n.weight
+		first := nodes[sort.Search(len(nodes), func(i int) bool { return nodes[i].weight >= w })]
+		if first != n {
+			m.swap(n, first)
+		}
+		n.weight--
+	}
+}
+
+// swap swaps 2 nodes (along with their subtrees) in the tree.
+// Neither of the nodes may be the ancestor of the other.
+func (m *fgk) swap(a, b *fgkNode) {
+	pa, pb := a.parent, b.parent
+	if pa == pb {
+		pa.left, pa.right = pa.right, pa.left
+	} else {
+		if pa.left == a {
+			pa.left = b
+		} else {
+			pa.right = b
+		}
+		if pb.left == b {
+			pb.left = a
+		} else {
+			pb.right = a
+		}
+		a.parent, b.parent = pb, pa
+	}
+
+	m.nodes[a.order], m.nodes[b.order] = b, a
+	a.order, b.order = b.order, a.order
+}
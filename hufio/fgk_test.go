@@ -0,0 +1,67 @@
+package hufio
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/icza/huffman"
+)
+
+// checkFGK checks the consistency of the tree and the sibling property.
+func checkFGK(t *testing.T, m *fgk) {
+	t.Helper()
+	for i, n := range m.nodes {
+		if n.order != i {
+			t.Fatalf("[%d] Got order: %d", i, n.order)
+		}
+		if i > 0 && m.nodes[i-1].weight > n.weight {
+			t.Fatalf("[%d] Weights not sorted: %d > %d", i, m.nodes[i-1].weight, n.weight)
+		}
+		if n == m.root {
+			if i != len(m.nodes)-1 || n.parent != nil {
+				t.Fatalf("[%d] Root is not the last", i)
+			}
+			continue
+		}
+		if n.parent.order <= i {
+			t.Fatalf("[%d] Parent precedes child", i)
+		}
+		if sibling := m.nodes[i^1]; sibling.parent != n.parent {
+			t.Fatalf("[%d] Siblings are not adjacent", i)
+		}
+		if n.left == nil {
+			if n.weight <= 0 {
+				t.Fatalf("[%d] Leaf weight: %d", i, n.weight)
+			}
+			if m.valueMap[n.value] != n {
+				t.Fatalf("[%d] Leaf is not in valueMap", i)
+			}
+		} else if n.weight != n.left.weight+n.right.weight || n.left.parent != n || n.right.parent != n {
+			t.Fatalf("[%d] Inconsistent internal node", i)
+		}
+	}
+	if len(m.valueMap) != (len(m.nodes)+1)/2 {
+		t.Fatalf("Got %d values, %d nodes", len(m.valueMap), len(m.nodes))
+	}
+}
+
+func TestFGKSiblingProperty(t *testing.T) {
+	dict, err := NewDict(map[huffman.ValueType]int{0: 30, 1: 7, 5: 7, 20: 1, 50: 2, 1000: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []*Dict{nil, dict} {
+		for _, winSize := range []int{-1, 1, 2, 5, 100} {
+			m := newFGK(checkOptions(&Options{WinSize: winSize, Dict: d}))
+			checkFGK(t, m)
+			for i := 0; i < 3000; i++ {
+				// Skewed distribution
+				v := huffman.ValueType(rand.Intn(1 + rand.Intn(40)))
+				m.add(v)
+				checkFGK(t, m)
+			}
+			m.reset()
+			checkFGK(t, m)
+		}
+	}
+}
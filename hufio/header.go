@@ -0,0 +1,153 @@
+/*
+
+Stream header implementation.
+
+*/
+
+package hufio
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
+)
+
+// magic is the magic bytes the stream header starts with.
+var magic = []byte("HUF")
+
+const (
+	// headerVersion is the version of the stream header format.
+	headerVersion = 1
+
+	// maxHeaderFieldsSize is the max size of the fields in the stream header.
+	maxHeaderFieldsSize = 256
+
+	// minHeaderFields is the number of fields always written (the dictionary field is optional).
+	minHeaderFields = 6
+)
+
+// ErrHeader is returned by Reader if the stream header is invalid or not supported.
+var ErrHeader = errors.New("hufio: invalid stream header")
+
+// writeHeader writes the stream header describing the options.
+//
+// The header is the magic bytes, the format version, the size of the fields in bytes,
+// the varint encoded fields, and the CRC-32 (IEEE) checksum of all these (4 bytes, big endian),
+// so a corrupted header (e.g. the Checksum option turned off) is detected.
+// New fields must be added to the end, optional fields missing from the end are treated as zero.
+// The dictionary field (ID+1 of Options.Dict) is only written if a dictionary is used,
+// so streams without a dictionary can be read by older versions.
+//
+// Returns the size of the header in bytes.
+func writeHeader(bw *bitio.Writer, o *Options) (n int, err error) {
+	fields := appendVarint(nil, int64(o.Mode))
+	fields = appendVarint(fields, int64(o.WinSize))
+	fields = appendVarint(fields, boolField(o.Checksum))
+	fields = appendVarint(fields, int64(o.BlockSize))
+	fields = appendVarint(fields, boolField(o.Seekable))
+	fields = appendVarint(fields, int64(o.LiteralBits))
+	if o.Dict != nil {
+		fields = appendVarint(fields, int64(o.Dict.ID())+1)
+	}
+
+	header := append(append([]byte(nil), magic...), headerVersion)
+	header = appendUvarint(header, uint64(len(fields)))
+	header = append(header, fields...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(header))
+	header = append(header, crc[:]...)
+	return bw.Write(header)
+}
+
+// readHeader reads the stream header, and returns the options it describes.
+// dict is the dictionary of the reader, ErrDict is returned if the stream uses a different one.
+func readHeader(br *huffman.BitReader, dict *Dict) (o *Options, err error) {
+	start := make([]byte, len(magic)+1)
+	if _, err = io.ReadFull(br, start); err != nil || string(start[:len(magic)]) != string(magic) ||
+		start[len(magic)] != headerVersion {
+		return nil, ErrHeader
+	}
+
+	size, err := binary.ReadUvarint(br)
+	if err != nil || size > maxHeaderFieldsSize {
+		return nil, ErrHeader
+	}
+	data := make([]byte, size+4)
+	if _, err = io.ReadFull(br, data); err != nil {
+		return nil, ErrHeader
+	}
+	crc := crc32.ChecksumIEEE(append(appendUvarint(start, size), data[:size]...))
+	if binary.BigEndian.Uint32(data[size:]) != crc {
+		return nil, ErrHeader
+	}
+	data = data[:size]
+
+	var fields []int64
+	for len(data) > 0 {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return nil, ErrHeader
+		}
+		fields = append(fields, v)
+		data = data[n:]
+	}
+	// field returns the ith field, 0 if it is missing.
+	field := func(i int) int64 {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return 0
+	}
+
+	if len(fields) < minHeaderFields || len(fields) > 7 {
+		return nil, ErrHeader // Missing fields, or unknown fields written by a newer version
+	}
+	o = &Options{
+		Mode:        Mode(field(0)),
+		WinSize:     int(field(1)),
+		Checksum:    field(2) == 1,
+		BlockSize:   int(field(3)),
+		Seekable:    field(4) == 1,
+		LiteralBits: int(field(5)),
+	}
+	if o.Mode < ModeDefault || o.Mode > ModeFGK || field(1) < math.MinInt32 || field(1) > math.MaxInt32 ||
+		field(2) < 0 || field(2) > 1 || field(3) < 0 || field(3) > MaxBlockSize ||
+		field(4) < 0 || field(4) > 1 || field(5) < 0 || field(5) > MaxLiteralBits ||
+		field(6) < 0 || field(6) > math.MaxUint32+1 || field(6) > 0 && o.Mode == ModeStatic {
+		return nil, ErrHeader
+	}
+	o.Header = true
+	if field(6) > 0 {
+		if dict == nil || field(6) != int64(dict.ID())+1 {
+			return nil, ErrDict
+		}
+		o.Dict = dict
+	}
+
+	return checkOptions(o), nil
+}
+
+// boolField returns the header field value of a bool option.
+func boolField(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// appendUvarint appends the uvarint encoded form of v to data.
+func appendUvarint(data []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+// appendVarint appends the varint encoded form of v to data.
+func appendVarint(data []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutVarint(buf[:], v)]...)
+}
@@ -0,0 +1,35 @@
+/*
+
+Adaptive symbol model abstraction.
+
+*/
+
+package hufio
+
+import "github.com/icza/huffman"
+
+// model is an adaptive symbol model: it provides the Huffman codes of the symbols,
+// and it is updated after each symbol.
+// Writer and Reader must use the same model, and update it in the same way.
+type model interface {
+	// code returns the Huffman code of the specified value, ok is false if the value is unknown.
+	code(value huffman.ValueType) (r uint64, bits byte, ok bool)
+
+	// decode reads a Huffman code and returns the value it denotes.
+	decode(br *huffman.BitReader) (value huffman.ValueType, err error)
+
+	// add updates the model with an occurrence of the specified value,
+	// which may be a known or a new (unknown) value.
+	add(value huffman.ValueType)
+
+	// reset resets the model to its initial state (only knowing newValue and eofValue).
+	reset()
+}
+
+// newModel creates a new model specified by the options.
+func newModel(o *Options) model {
+	if o.Mode == ModeFGK {
+		return newFGK(o)
+	}
+	return newSymbols(o)
+}
@@ -16,8 +16,101 @@ type Options struct {
 	// Negative values mean not to use a sliding window, that is, symbol table is
 	// calculated based on all previously encountered symbols.
 	WinSize int
+
+	// Mode specifies the coding mode.
+	// ModeDefault (the zero value) means to use ModeAdaptive.
+	Mode Mode
+
+	// Header tells if the stream starts with a header describing the options.
+	// If true, Writer writes the header, and Reader reads the options from the header
+	// (all other fields of the Reader's Options except Concurrency and Dict are ignored).
+	// The header has its own checksum, Reader reports ErrHeader if it is invalid or corrupted.
+	Header bool
+
+	// Checksum tells if the Writer appends a checksum (CRC-32) and the length of the uncompressed data
+	// after the compressed data, which is verified by the Reader.
+	// Reader reports ErrChecksum if verification fails, and ErrCorrupt if the stream ends prematurely.
+	// In block mode each block has its own checksum, and the end frame is followed by the number
+	// and the total size of the frames, so lost frames are also detected (reported as ErrCorrupt).
+	Checksum bool
+
+	// BlockSize specifies the size of blocks (in bytes / symbols) the data is split into.
+	// Each block is encoded independently (starting with a fresh symbol table),
+	// and is written in a size prefixed frame.
+	// 0 (or a negative value) means not to use blocks, the whole data is encoded as one.
+	// Values greater than MaxBlockSize are treated as MaxBlockSize.
+	//
+	// If a block is found to be corrupted, Reader reports the error, but subsequent reads
+	// continue with the next block (unless the framing itself is corrupted).
+	//
+	// Blocks are decoded using lookup tables only in ModeStatic, see there.
+	BlockSize int
+
+	// Concurrency specifies the number of goroutines used to encode / decode blocks in block mode
+	// (see BlockSize), it also limits the number of blocks buffered ahead.
+	// 0 (or 1) means blocks are encoded / decoded sequentially, on the calling goroutine.
+	// This option is not transmitted in the stream header, the Reader always uses its own value.
+	Concurrency int
+
+	// Seekable tells if the Writer appends a block index to the stream, which allows random access
+	// using SeekableReader. Seekable streams are always written in block mode:
+	// if BlockSize is not positive, the default block size (64 KiB) is used.
+	Seekable bool
+
+	// LiteralBits specifies the number of bits used to write the values of new symbols
+	// (symbols not yet in the symbol table). This also defines the alphabet:
+	// symbol values must be in the range [0, 1<<LiteralBits).
+	// 0 (or a negative value) means to use the default value 8 (the byte alphabet).
+	// Values greater than MaxLiteralBits are treated as MaxLiteralBits.
+	// Writer and Reader handle bytes (reporting ErrValueRange for bytes / values outside of the alphabet),
+	// use SymbolWriter and SymbolReader for other alphabets.
+	LiteralBits int
+
+	// Dict specifies a preset dictionary used to seed the symbol table in adaptive modes
+	// (at the start of the stream, and at the start of each block in block mode),
+	// so short data having a known distribution compresses well. It is not used in static mode.
+	// nil means not to use a dictionary.
+	// The dictionary is not transmitted, the Reader must use the same dictionary as the Writer did.
+	// If Header is true, the ID of the dictionary is written to the stream header, and Reader
+	// reports ErrDict if it does not have the same dictionary (Reader always uses its own Dict).
+	Dict *Dict
 }
 
+// MaxLiteralBits is the max value of Options.LiteralBits.
+const MaxLiteralBits = 30
+
+// MaxBlockSize is the max value of Options.BlockSize.
+const MaxBlockSize = 1 << 24
+
+// Mode is the coding mode of Huffman Readers and Writers.
+type Mode int
+
+const (
+	// ModeDefault is the default mode, which is ModeAdaptive.
+	ModeDefault Mode = iota
+
+	// ModeAdaptive is the adaptive mode: the symbol table is updated after each symbol,
+	// using the sliding window if enabled.
+	ModeAdaptive
+
+	// ModeStatic is the static (two-pass) mode: Writer buffers all data until it is closed,
+	// then counts the frequencies of symbols, writes a canonical code table and encodes
+	// the data using this fixed code. WinSize is not used in this mode.
+	// Without blocks the whole data is buffered in memory (1 byte per byte, 4 bytes per symbol of larger
+	// alphabets), so for large or unbounded data combine ModeStatic with BlockSize, which limits the
+	// buffered data to a block.
+	//
+	// Reader decodes static data using multi-level lookup tables, which is much faster than walking the tree
+	// bit by bit as done in adaptive modes (where the tree changes after each symbol, also in block mode).
+	// Use ModeStatic with BlockSize when decoding speed matters.
+	ModeStatic
+
+	// ModeFGK is an adaptive mode using the FGK (Faller-Gallager-Knuth) algorithm:
+	// instead of rebuilding the Huffman tree after each symbol (like ModeAdaptive does),
+	// the tree is updated in place, which is much faster. The sliding window is used if enabled.
+	ModeFGK
+)
+
 // checkOptions returns a new Options where "missing" fields (with zero value) are set to default values.
 // The passed options is not modified.
 // It is allowed to pass nil, which is treated as the zero value of Options.
@@ -31,5 +124,28 @@ func checkOptions(o *Options) *Options {
 		o2.WinSize = 2048
 	}
 
+	if o2.BlockSize < 0 {
+		o2.BlockSize = 0 // Negative values are not transmitted in the stream header
+	} else if o2.BlockSize > MaxBlockSize {
+		o2.BlockSize = MaxBlockSize
+	}
+	if o2.Seekable && o2.BlockSize == 0 {
+		o2.BlockSize = 64 * 1024
+	}
+
+	if o2.LiteralBits <= 0 {
+		o2.LiteralBits = 8
+	} else if o2.LiteralBits > MaxLiteralBits {
+		o2.LiteralBits = MaxLiteralBits
+	}
+
+	if o2.Mode == ModeDefault {
+		o2.Mode = ModeAdaptive
+	}
+
+	if o2.Mode == ModeStatic {
+		o2.Dict = nil
+	}
+
 	return o2
 }
@@ -7,17 +7,36 @@ Huffman code Reader implementation.
 package hufio
 
 import (
+	"errors"
 	"io"
+	"sync"
 
-	"github.com/icza/bitio"
 	"github.com/icza/huffman"
 )
 
+// errSync is returned internally when a sync marker (written by Writer.Flush()) is read.
+var errSync = errors.New("hufio: sync point")
+
 // Reader is the Huffman reader implementation.
 // It also implements io.ByteReader.
 type Reader struct {
-	*symbols
-	br *bitio.Reader
+	br   *huffman.BitReader
+	o    *Options
+	opts *Options // Options the Reader was created with (o may come from the stream header)
+
+	header  bool                // Tells if the stream header is yet to be read
+	dec     *decoder            // Decoder of the data, nil in block mode
+	fr      *frameReader        // Reader of the frames in block mode
+	block   []huffman.ValueType // Decoded data of the current block in block mode
+	pos     int                 // Position of the next value in block
+	err     error               // Error reading frames (io.EOF if the end frame has been read) in block mode
+	pending []chan *blockResult // Blocks being decoded concurrently, in order
+
+	// Frames are read ahead on a background goroutine if Options.Concurrency > 1,
+	// mu guards err and pending in this case.
+	mu      sync.Mutex
+	cond    *sync.Cond // Signaled if a frame is read ahead, or reading ahead stops
+	reading bool       // Tells if frames are being read ahead
 }
 
 // NewReader returns a new Reader using the specified io.Reader as the input (source),
@@ -29,51 +48,384 @@ func NewReader(in io.Reader) *Reader {
 // NewReaderOptions returns a new Reader using the specified io.Reader as the input (source)
 // with the specified Options.
 //
-// Note: Options are not transmitted internally! The Reader will only be able to properly decode the stream
-// created by a Writer if the same Options is used both at the Reader and Writer.
-// Transmitting the Options has to be done manually if needed.
+// Note: Options are only transmitted if Options.Header is true! Else the Reader will only be able to
+// properly decode the stream created by a Writer if the same Options is used both at the Reader and Writer.
+//
+// If Options.Header is true, the stream header is read (and the Options it describes are used)
+// when the first byte is read.
 func NewReaderOptions(in io.Reader, o *Options) *Reader {
 	o = checkOptions(o)
-	return &Reader{symbols: newSymbols(o), br: bitio.NewReader(in)}
+	r := &Reader{br: huffman.NewBitReader(in), o: o, opts: o, header: o.Header}
+	r.cond = sync.NewCond(&r.mu)
+	if !r.header {
+		r.init()
+	}
+	return r
+}
+
+// Reset discards the state of the Reader and makes it equivalent to the result of
+// NewReaderOptions() with the specified source and the original Options,
+// but the allocated buffers (symbol table, input buffer) are reused.
+//
+// Reset allows reusing Readers (e.g. with sync.Pool) to decompress many small streams.
+// If frames are being read ahead from the previous source (see Options.Concurrency),
+// Reset does not wait for that, the previous source is abandoned.
+func (r *Reader) Reset(in io.Reader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Wait for blocks being decoded:
+	for _, ch := range r.pending {
+		<-ch
+	}
+	r.pending = r.pending[:0]
+
+	if r.reading {
+		// The old source is still being read (and may block): abandon it along with its BitReader
+		r.br, r.reading = huffman.NewBitReader(in), false
+	} else {
+		r.br.Reset(in)
+	}
+	r.o, r.header = r.opts, r.opts.Header
+	r.fr, r.block, r.pos, r.err = nil, nil, 0, nil
+	if !r.header {
+		r.init()
+	}
+}
+
+// init initializes the Reader based on its Options.
+// The decoder of the previous stream (see Reset()) is reused if it uses the same Options.
+func (r *Reader) init() {
+	switch {
+	case r.o.BlockSize > 0:
+		r.dec, r.fr = nil, &frameReader{br: r.br, o: r.o}
+	case r.dec != nil && *r.dec.o == *r.o:
+		r.dec.reset()
+	default:
+		r.dec = newDecoder(r.br, r.o)
+	}
+}
+
+// readHeader reads the stream header, and initializes the Reader using the Options it describes.
+func (r *Reader) readHeader() error {
+	o, err := readHeader(r.br, r.o.Dict)
+	if err != nil {
+		return err
+	}
+	o.Concurrency = r.o.Concurrency // Not transmitted
+	r.o, r.header = o, false
+	r.init()
+	return nil
 }
 
 // Read decompresses up to len(p) bytes from the source.
+//
+// Read returns early (with less than len(p) bytes) at sync points (see Writer.Flush) and at the end of blocks,
+// so data is returned as soon as it is available.
 func (r *Reader) Read(p []byte) (n int, err error) {
-	for i := range p {
-		if p[i], err = r.ReadByte(); err != nil {
-			return i, err
+	for n < len(p) {
+		if n > 0 && r.dec == nil && r.pos == len(r.block) {
+			return // End of block
 		}
+		var v huffman.ValueType
+		if v, err = r.next(); err != nil {
+			if err == errSync {
+				if err = nil; n > 0 {
+					return
+				}
+				continue
+			}
+			return
+		}
+		if v > 255 {
+			return n, ErrValueRange
+		}
+		p[n] = byte(v)
+		n++
 	}
-	return len(p), nil
+	return
 }
 
 // ReadByte decompresses a single byte.
+// ErrValueRange is returned if the stream contains a value that is not a byte.
 func (r *Reader) ReadByte() (b byte, err error) {
-	// Read Huffman code
-	br := r.br
-	node := r.root
-	for node.Left != nil { // read until we reach a leaf
-		var right bool
-		if right, err = br.ReadBool(); err != nil {
+	v, err := r.readValue()
+	if err != nil {
+		return
+	}
+	if v > 255 {
+		return 0, ErrValueRange
+	}
+	return byte(v), nil
+}
+
+// readValue decompresses a single value, skipping sync points.
+func (r *Reader) readValue() (v huffman.ValueType, err error) {
+	for {
+		if v, err = r.next(); err != errSync {
 			return
-		} else if right {
-			node = node.Right
+		}
+	}
+}
+
+// next decompresses a single value.
+// errSync is returned if a sync point is reached.
+func (r *Reader) next() (v huffman.ValueType, err error) {
+	if r.header {
+		if err = r.readHeader(); err != nil {
+			return
+		}
+	}
+
+	if r.dec == nil {
+		if r.pos == len(r.block) {
+			if err = r.nextBlock(); err != nil {
+				return
+			}
+		}
+		v = r.block[r.pos]
+		r.pos++
+		return
+	}
+
+	return r.dec.readValue()
+}
+
+// nextBlock reads and decodes the next block in block mode.
+// io.EOF is returned if there are no more blocks.
+func (r *Reader) nextBlock() (err error) {
+	var res *blockResult
+	if r.o.Concurrency <= 1 {
+		var frame []byte
+		if frame, err = r.readFrame(); err != nil {
+			return
+		}
+		res = &blockResult{}
+		res.values, res.err = decodeBlock(frame, r.o)
+	} else {
+		// Frames are read ahead and decoded concurrently. The oldest block is returned as soon as
+		// it is decoded, not waiting for further frames (which may not be available yet, e.g. after Writer.Flush()).
+		r.mu.Lock()
+		r.startReading()
+		for len(r.pending) == 0 && r.reading {
+			r.cond.Wait()
+		}
+		if len(r.pending) == 0 {
+			err = r.err
+			r.mu.Unlock()
+			return
+		}
+		ch := r.pending[0]
+		r.pending = append(r.pending[:0], r.pending[1:]...)
+		r.startReading() // There's room for a new frame
+		r.mu.Unlock()
+		res = <-ch
+	}
+
+	if res.err != nil {
+		return res.err
+	}
+	r.block, r.pos = res.values, 0
+	return
+}
+
+// startReading starts reading frames ahead on a new goroutine (if not already reading,
+// and the max number of pending blocks is not reached). r.mu must be locked.
+func (r *Reader) startReading() {
+	if r.reading || r.err != nil || len(r.pending) >= r.o.Concurrency {
+		return
+	}
+	r.reading = true
+	go r.readAhead(r.fr)
+}
+
+// readAhead reads frames using fr, and starts decoding them until the max number of pending blocks
+// is reached or an error occurs. Results are discarded if the Reader is reset in the meantime.
+func (r *Reader) readAhead(fr *frameReader) {
+	o := fr.o
+	for {
+		frame, err := fr.next()
+
+		r.mu.Lock()
+		if fr != r.fr {
+			r.mu.Unlock()
+			return // Abandoned by Reset()
+		}
+		if err != nil {
+			r.err, r.reading = err, false
 		} else {
-			node = node.Left
+			ch := make(chan *blockResult, 1)
+			go func() {
+				data, err := decodeBlock(frame, o)
+				ch <- &blockResult{values: data, err: err}
+			}()
+			r.pending = append(r.pending, ch)
+			r.reading = len(r.pending) < o.Concurrency
 		}
+		reading := r.reading
+		r.cond.Broadcast()
+		r.mu.Unlock()
+
+		if !reading {
+			return
+		}
+	}
+}
+
+// readFrame reads the next frame in block mode.
+// Errors are sticky as the framing can't be recovered.
+func (r *Reader) readFrame() (frame []byte, err error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if frame, err = r.fr.next(); err != nil {
+		r.err = err
+	}
+	return
+}
+
+// decoder decodes a segment written by an encoder.
+type decoder struct {
+	br *huffman.BitReader
+	o  *Options
+
+	m      model          // Symbol model, nil in static mode
+	static *huffman.Table // Code table in static mode, nil until read
+	eof    bool           // Tells if eofValue has been read (and the trailer is verified)
+	err    error          // Sticky error, returned by all subsequent reads (io.EOF at the end)
+	crc    uint32         // Checksum of the uncompressed data (if Options.Checksum)
+	n      uint64         // Length of the uncompressed data (if Options.Checksum)
+}
+
+// newDecoder creates a new decoder.
+func newDecoder(br *huffman.BitReader, o *Options) *decoder {
+	d := &decoder{br: br, o: o}
+	if o.Mode != ModeStatic {
+		d.m = newModel(o)
+	}
+	return d
+}
+
+// reset resets the decoder to start a new segment.
+func (d *decoder) reset() {
+	if d.m != nil {
+		d.m.reset()
+	}
+	d.static, d.eof, d.err, d.crc, d.n = nil, false, nil, 0, 0
+}
+
+// readValue decodes a single value.
+// io.EOF is returned if eofValue is read (and the trailer is verified),
+// errSync if a sync marker is read.
+// Errors are sticky: once an error is returned (e.g. ErrChecksum), all subsequent calls return it.
+func (d *decoder) readValue() (v huffman.ValueType, err error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if v, err = d.read(); err != nil && err != errSync {
+		d.err = err
+	}
+	return
+}
+
+// read decodes a single value, see readValue().
+func (d *decoder) read() (v huffman.ValueType, err error) {
+
+	var eof bool
+	if d.m == nil {
+		v, eof, err = d.readStatic()
+	} else {
+		v, eof, err = d.readAdaptive()
+	}
+
+	switch {
+	case err == errSync:
+		return
+	case err != nil:
+		if (err == io.EOF || err == io.ErrUnexpectedEOF) && d.o.Checksum {
+			err = ErrCorrupt // Stream ended before eofValue
+		}
+		return
+	case eof:
+		if d.o.Checksum {
+			if err = readTrailer(d.br, d.crc, d.n); err != nil {
+				return
+			}
+		}
+		d.eof = true
+		return 0, io.EOF
+	}
+
+	if d.o.Checksum {
+		d.crc = updateCRCValue(d.crc, v, d.o)
+		d.n++
+	}
+	return
+}
+
+// readAdaptive decodes a single value in adaptive mode.
+// eof tells if eofValue is read.
+func (d *decoder) readAdaptive() (v huffman.ValueType, eof bool, err error) {
+	if v, err = d.m.decode(d.br); err != nil {
+		return
 	}
 
-	switch node.Value {
+	switch v {
 	case newValue:
-		if b, err = br.ReadByte(); err != nil {
+		var u uint64
+		if u, err = d.br.ReadBits(uint8(d.o.LiteralBits)); err != nil {
 			return
 		}
-		r.insert(huffman.ValueType(b))
-		return
+		v = huffman.ValueType(u)
+		if _, _, ok := d.m.code(v); ok {
+			// A known value sent as a new value is a sync marker, the stream is aligned after it
+			d.br.Align()
+			return 0, false, errSync
+		}
 	case eofValue:
-		return 0, io.EOF
-	default:
-		r.update(node)
-		return byte(node.Value), nil
+		return 0, true, nil
+	}
+
+	d.m.add(v)
+	return v, false, nil
+}
+
+// readStatic decodes a single value in static mode.
+// eof tells if eofValue is read.
+func (d *decoder) readStatic() (v huffman.ValueType, eof bool, err error) {
+	if d.static == nil {
+		if d.static, err = readStaticTable(d.br, d.o); err != nil {
+			return
+		}
+	}
+
+	if v, err = d.static.Decode(d.br); err != nil {
+		if err == huffman.ErrInvalidCode {
+			err = ErrCorrupt
+		}
+		return
+	}
+	switch {
+	case v == eofValue:
+		return 0, true, nil
+	case !validValue(v, d.o):
+		return 0, false, ErrCorrupt
+	}
+	return v, false, nil
+}
+
+// readLeaf reads a Huffman code, and returns the leaf of the specified tree it denotes.
+func readLeaf(br *huffman.BitReader, root *huffman.Node) (node *huffman.Node, err error) {
+	node = root
+	for node.Left != nil { // read until we reach a leaf
+		var right bool
+		if right, err = br.ReadBool(); err != nil {
+			return
+		} else if right {
+			node = node.Right
+		} else {
+			node = node.Left
+		}
 	}
+	return
 }
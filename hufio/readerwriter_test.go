@@ -2,13 +2,18 @@ package hufio
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"testing"
 	"time"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
 )
 
 func init() {
@@ -29,6 +34,15 @@ func TestOptions(t *testing.T) {
 		{"Options [WinSize= 3]", data, &Options{WinSize: 3}},
 		{"Options [WinSize= 1]", data, &Options{WinSize: 1}},
 		{"Options [WinSize=-1]", data, &Options{WinSize: -1}},
+		{"Options [Adaptive]", data, &Options{Mode: ModeAdaptive}},
+		{"Options [Static]", data, &Options{Mode: ModeStatic}},
+		{"Options [Static,empty]", nil, &Options{Mode: ModeStatic}},
+		{"Options [Static,1]", []byte{'x'}, &Options{Mode: ModeStatic}},
+		{"Options [FGK]", data, &Options{Mode: ModeFGK}},
+		{"Options [FGK,WinSize= 3]", data, &Options{Mode: ModeFGK, WinSize: 3}},
+		{"Options [FGK,WinSize= 1]", data, &Options{Mode: ModeFGK, WinSize: 1}},
+		{"Options [FGK,WinSize=-1]", data, &Options{Mode: ModeFGK, WinSize: -1}},
+		{"Options [FGK,empty]", nil, &Options{Mode: ModeFGK}},
 	}
 
 	for _, v := range cases {
@@ -108,6 +122,857 @@ func testWriteAndRead(testCase string, data []byte, t *testing.T, os ...*Options
 	}
 }
 
+func TestFGK(t *testing.T) {
+	data := make([]byte, dataSize)
+	for i := range data {
+		data[i] = byte(rand.Int31n(256))
+	}
+	testWriteAndRead("FGK Random Bytes", data, t, &Options{Mode: ModeFGK})
+	testWriteAndRead("FGK Random Bytes W16", data, t, &Options{Mode: ModeFGK, WinSize: 16})
+
+	for _, fname := range []string{"wiki_huffman.html_", "wiki_huffman.zip"} {
+		data, err := ioutil.ReadFile("_test_files/" + fname)
+		if err != nil {
+			t.Error("Can't read input:", err)
+		}
+		testWriteAndRead("FGK "+fname, data, t, &Options{Mode: ModeFGK})
+	}
+}
+
+func TestStatic(t *testing.T) {
+	o := &Options{Mode: ModeStatic}
+
+	data := make([]byte, dataSize)
+	for i := range data {
+		data[i] = byte(rand.Int31n(256))
+	}
+	testWriteAndRead("Static Random Bytes", data, t, o)
+
+	// Bytes are buffered using 1 byte per value
+	w := NewWriterOptions(ioutil.Discard, o)
+	w.Write(data)
+	if len(w.enc.byteData) != len(data) || len(w.enc.data) != 0 {
+		t.Errorf("Got: %d buffered bytes, %d buffered values, want: %d, 0", len(w.enc.byteData), len(w.enc.data), len(data))
+	}
+
+	for _, fname := range []string{"wiki_huffman.html_", "wiki_huffman.zip"} {
+		data, err := ioutil.ReadFile("_test_files/" + fname)
+		if err != nil {
+			t.Error("Can't read input:", err)
+		}
+		testWriteAndRead("Static "+fname, data, t, o)
+	}
+
+	// Skewed (Fibonacci) distribution for long codes, decoded using multiple lookup table levels
+	data = data[:0]
+	for i, a, b := 0, 1, 1; i < 25; i, a, b = i+1, b, a+b {
+		data = append(data, bytes.Repeat([]byte{byte(i)}, a)...)
+	}
+	rand.Shuffle(len(data), func(i, j int) { data[i], data[j] = data[j], data[i] })
+	testWriteAndRead("Static Fibonacci", data, t, o)
+
+	testWriteAndRead("Static Single Byte", []byte{'a'}, t, o)
+	testWriteAndRead("Static Empty Checksum", nil, t, &Options{Mode: ModeStatic, Checksum: true})
+}
+
+func BenchmarkReadStatic(b *testing.B) {
+	data, err := ioutil.ReadFile("_test_files/wiki_huffman.html_")
+	if err != nil {
+		b.Fatal("Can't read input:", err)
+	}
+	o := &Options{Mode: ModeStatic}
+	buf := &bytes.Buffer{}
+	w := NewWriterOptions(buf, o)
+	w.Write(data)
+	w.Close()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(ioutil.Discard, NewReaderOptions(bytes.NewReader(buf.Bytes()), o)); err != nil {
+			b.Fatal("Failed to read:", err)
+		}
+	}
+}
+
+func BenchmarkReadBlocks(b *testing.B) {
+	data, err := ioutil.ReadFile("_test_files/wiki_huffman.html_")
+	if err != nil {
+		b.Fatal("Can't read input:", err)
+	}
+
+	cases := []struct {
+		name string
+		o    *Options
+	}{
+		{"Adaptive", &Options{BlockSize: 4096}},
+		{"FGK", &Options{BlockSize: 4096, Mode: ModeFGK}},
+		{"Static", &Options{BlockSize: 4096, Mode: ModeStatic}},
+		{"Static,Conc=4", &Options{BlockSize: 4096, Mode: ModeStatic, Concurrency: 4}},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		w := NewWriterOptions(buf, c.o)
+		w.Write(data)
+		w.Close()
+
+		b.Run(c.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := io.Copy(ioutil.Discard, NewReaderOptions(bytes.NewReader(buf.Bytes()), c.o)); err != nil {
+					b.Fatal("Failed to read:", err)
+				}
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	data := []byte("testing, testing ttttttttttttt")
+	cases := []struct {
+		name string
+		data []byte
+		o    *Options
+	}{
+		{"Header Default", data, &Options{Header: true}},
+		{"Header [WinSize= 3]", data, &Options{Header: true, WinSize: 3}},
+		{"Header [WinSize=-1]", data, &Options{Header: true, WinSize: -1}},
+		{"Header [WinSize=2^31-1]", data, &Options{Header: true, WinSize: 1<<31 - 1}}, // Window is not allocated up front
+		{"Header [FGK,WinSize=2^31-1]", data, &Options{Header: true, Mode: ModeFGK, WinSize: 1<<31 - 1}},
+		{"Header [Static]", data, &Options{Header: true, Mode: ModeStatic}},
+		{"Header [BlockSize=-1]", data, &Options{Header: true, BlockSize: -1}},
+		{"Header [empty]", nil, &Options{Header: true}},
+	}
+
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		w := NewWriterOptions(buf, c.o)
+		if _, err := w.Write(c.data); err != nil {
+			t.Errorf("[%s] Failed to write: %v", c.name, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("[%s] Failed to close: %v", c.name, err)
+		}
+
+		// Reader must only know that there is a header
+		r := NewReaderOptions(bytes.NewReader(buf.Bytes()), &Options{Header: true, WinSize: 1})
+		data2, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("[%s] Failed to read: %v", c.name, err)
+		}
+		if !bytes.Equal(c.data, data2) {
+			t.Errorf("[%s] Decoded doesn't match original!", c.name)
+		}
+	}
+
+	// header returns a stream header with the specified fields and a valid checksum.
+	header := func(fields ...int64) []byte {
+		var data []byte
+		for _, f := range fields {
+			data = appendVarint(data, f)
+		}
+		h := append(appendUvarint([]byte("HUF\x01"), uint64(len(data))), data...)
+		crc := make([]byte, 4)
+		binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(h))
+		return append(h, crc...)
+	}
+
+	invalids := [][]byte{
+		nil,
+		[]byte("HUX\x01\x00"),
+		[]byte("HUF\x02\x00"),
+		header(1, 2048, 0, 0, 0, 8, 0, 1), // Unknown field
+		header(8, 2048, 0, 0, 0, 8),       // Invalid mode
+		header(1, 2048, 0, 0, 0),          // Missing field
+		header(1, 2048, 0)[:7],            // Truncated
+	}
+	badCRC := header(1, 2048, 0, 0, 0, 8)
+	badCRC[len(badCRC)-1] ^= 1
+	invalids = append(invalids, badCRC)
+	for i, v := range invalids {
+		r := NewReaderOptions(bytes.NewReader(v), &Options{Header: true})
+		if _, err := r.ReadByte(); err != ErrHeader {
+			t.Errorf("[%d] Got: %v, want: %v", i, err, ErrHeader)
+		}
+	}
+
+	// Untrusted BlockSize must not cause huge allocations
+	r := NewReaderOptions(bytes.NewReader(header(1, 2048, 0, MaxBlockSize+1, 0, 8)), &Options{Header: true})
+	if _, err := r.ReadByte(); err != ErrHeader {
+		t.Errorf("Got: %v, want: %v", err, ErrHeader)
+	}
+	stream := append(header(1, 2048, 0, MaxBlockSize, 0, 8), appendUvarint(nil, uint64(maxFrameSize(checkOptions(&Options{BlockSize: MaxBlockSize}))))...)
+	for _, frame := range [][]byte{{0xff, 0xff, 0x01}, {0x80, 0x00, 0x00, 0x00, 0x80}} {
+		r = NewReaderOptions(bytes.NewReader(append(stream[:len(stream):len(stream)], frame...)), &Options{Header: true})
+		if _, err := r.ReadByte(); err != io.ErrUnexpectedEOF {
+			t.Errorf("Got: %v, want: %v", err, io.ErrUnexpectedEOF)
+		}
+	}
+	values, err := decodeBlock([]byte{0x80, 0x00, 0x00}, checkOptions(&Options{BlockSize: MaxBlockSize}))
+	if err != nil || cap(values) > 3*8 {
+		t.Errorf("Got: cap=%d, %v, want: cap<=%d", cap(values), err, 3*8)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	data, err := ioutil.ReadFile("_test_files/wiki_huffman.html_")
+	if err != nil {
+		t.Error("Can't read input:", err)
+	}
+	data = data[:2000]
+
+	for _, o := range []*Options{{Checksum: true}, {Checksum: true, Mode: ModeStatic}} {
+		testWriteAndRead("Checksum", data, t, o)
+		testWriteAndRead("Checksum [empty]", nil, t, o)
+
+		buf := &bytes.Buffer{}
+		w := NewWriterOptions(buf, o)
+		if _, err := w.Write(data); err != nil {
+			t.Error("Failed to write:", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Error("Failed to close:", err)
+		}
+		encoded := buf.Bytes()
+
+		// Flip bits and truncate the stream at random positions, corruption must be detected
+		for i := 0; i < 40; i++ {
+			corrupted := append([]byte(nil), encoded...)
+			pos := rand.Intn(len(corrupted))
+			corrupted[pos] ^= 1 << uint(rand.Intn(8))
+			if i%2 == 1 {
+				corrupted = encoded[:pos]
+			}
+			r := NewReaderOptions(bytes.NewReader(corrupted), o)
+			_, err := ioutil.ReadAll(r)
+			if err != ErrChecksum && err != ErrCorrupt {
+				t.Errorf("[Mode=%d, pos=%d] Got: %v, want: %v or %v", o.Mode, pos, err, ErrChecksum, ErrCorrupt)
+			}
+			// Error must be sticky
+			if _, err2 := r.Read(make([]byte, 1)); err2 != err {
+				t.Errorf("[Mode=%d, pos=%d] Got: %v, want: %v", o.Mode, pos, err2, err)
+			}
+		}
+
+		// Corrupted checksum in the trailer (data is decoded fine), error must be sticky
+		corrupted := append([]byte(nil), encoded...)
+		corrupted[len(corrupted)-3] ^= 1
+		r := NewReaderOptions(bytes.NewReader(corrupted), o)
+		if data2, err := ioutil.ReadAll(r); err != ErrChecksum || !bytes.Equal(data, data2) {
+			t.Errorf("[Mode=%d] Got: %d bytes, %v, want: %d bytes, %v", o.Mode, len(data2), err, len(data), ErrChecksum)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := r.ReadByte(); err != ErrChecksum {
+				t.Errorf("[Mode=%d] Got: %v, want: %v", o.Mode, err, ErrChecksum)
+			}
+		}
+	}
+}
+
+func TestHeaderChecksum(t *testing.T) {
+	data := []byte("testing, testing ttttttttttttt")
+	for _, o := range []*Options{{Header: true, Checksum: true}, {Header: true, Checksum: true, BlockSize: 10}} {
+		buf := &bytes.Buffer{}
+		w := NewWriterOptions(buf, o)
+		if _, err := w.Write(data); err != nil {
+			t.Error("Failed to write:", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Error("Failed to close:", err)
+		}
+		encoded := buf.Bytes()
+		headerSize, err := writeHeader(bitio.NewWriter(&bytes.Buffer{}), checkOptions(o))
+		if err != nil {
+			t.Error("Failed to write header:", err)
+		}
+
+		// Flip each bit of the header (e.g. turning Checksum off), corruption must be detected
+		for i := 0; i < headerSize*8; i++ {
+			corrupted := append([]byte(nil), encoded...)
+			corrupted[i/8] ^= 1 << uint(i%8)
+			r := NewReaderOptions(bytes.NewReader(corrupted), &Options{Header: true})
+			if data2, err := ioutil.ReadAll(r); err != ErrHeader {
+				t.Errorf("[BlockSize=%d, bit=%d] Got: %d bytes, %v, want: %v", o.BlockSize, i, len(data2), err, ErrHeader)
+			}
+		}
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	data, err := ioutil.ReadFile("_test_files/wiki_huffman.html_")
+	if err != nil {
+		t.Error("Can't read input:", err)
+	}
+	data = data[:20000]
+
+	cases := []struct {
+		name string
+		data []byte
+		o    *Options
+	}{
+		{"Blocks [1]", data[:100], &Options{BlockSize: 1}},
+		{"Blocks [1000]", data, &Options{BlockSize: 1000}},
+		{"Blocks [1000,FGK]", data, &Options{BlockSize: 1000, Mode: ModeFGK}},
+		{"Blocks [1000,Static]", data, &Options{BlockSize: 1000, Mode: ModeStatic}},
+		{"Blocks [4096,Static]", data, &Options{BlockSize: 4096, Mode: ModeStatic}},
+		{"Blocks [1000,Checksum]", data, &Options{BlockSize: 1000, Checksum: true}},
+		{"Blocks [1000,empty]", nil, &Options{BlockSize: 1000}},
+		{"Blocks [10000,FGK,1]", data[:1], &Options{BlockSize: 10000, Mode: ModeFGK}},
+		{"Blocks [1000,Conc=4]", data, &Options{BlockSize: 1000, Concurrency: 4}},
+		{"Blocks [999,FGK,Conc=3]", data, &Options{BlockSize: 999, Mode: ModeFGK, Concurrency: 3}},
+		{"Blocks [1000,Conc=64]", data, &Options{BlockSize: 1000, Mode: ModeStatic, Concurrency: 64}},
+		{"Blocks [1000,Conc=4,empty]", nil, &Options{BlockSize: 1000, Concurrency: 4}},
+	}
+	for _, c := range cases {
+		testWriteAndRead(c.name, c.data, t, c.o)
+	}
+
+	// Header must transmit the block size
+	buf := &bytes.Buffer{}
+	w := NewWriterOptions(buf, &Options{Header: true, BlockSize: 1000, Mode: ModeFGK})
+	w.Write(data)
+	w.Close()
+	data2, err := ioutil.ReadAll(NewReaderOptions(bytes.NewReader(buf.Bytes()), &Options{Header: true}))
+	if err != nil || !bytes.Equal(data, data2) {
+		t.Errorf("Decoded doesn't match original, error: %v", err)
+	}
+
+	// Corruption in a block: data of preceding blocks must be decoded,
+	// and reading may continue with the next block
+	o := &Options{BlockSize: 1000, Mode: ModeFGK, Checksum: true}
+	buf.Reset()
+	w = NewWriterOptions(buf, o)
+	w.Write(data)
+	w.Close()
+	corrupted := append([]byte(nil), buf.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 0x10
+	for _, conc := range []int{1, 4} {
+		o.Concurrency = conc
+		r := NewReaderOptions(bytes.NewReader(corrupted), o)
+		data2, err = ioutil.ReadAll(r)
+		if err != ErrChecksum && err != ErrCorrupt {
+			t.Errorf("Got: %v, want: %v or %v", err, ErrChecksum, ErrCorrupt)
+		}
+		if len(data2) < len(data)/3 || len(data2)%1000 != 0 || !bytes.Equal(data2, data[:len(data2)]) {
+			t.Errorf("Got %d bytes before corrupted block", len(data2))
+		}
+		data3, err := ioutil.ReadAll(r)
+		if err != nil || len(data2)+1000+len(data3) != len(data) || !bytes.Equal(data3, data[len(data)-len(data3):]) {
+			t.Errorf("Got %d bytes after corrupted block, error: %v", len(data3), err)
+		}
+	}
+
+	// Truncated stream (missing end frame)
+	_, err = ioutil.ReadAll(NewReaderOptions(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), o))
+	if err != ErrCorrupt {
+		t.Errorf("Got: %v, want: %v", err, ErrCorrupt)
+	}
+	// Frame size corrupted to zero (ending the stream early) must be detected
+	o = &Options{BlockSize: 50, Checksum: true}
+	buf.Reset()
+	w = NewWriterOptions(buf, o)
+	w.Write(data[:200])
+	w.Close()
+	corrupted = append([]byte(nil), buf.Bytes()...)
+	size, n := binary.Uvarint(corrupted)
+	corrupted[n+int(size)] = 0 // Size of the second frame
+	for _, conc := range []int{1, 4} {
+		o.Concurrency = conc
+		data2, err = ioutil.ReadAll(NewReaderOptions(bytes.NewReader(corrupted), o))
+		if err != ErrCorrupt || !bytes.Equal(data2, data[:50]) {
+			t.Errorf("[Conc=%d] Got: %d bytes, %v, want: %d bytes, %v", conc, len(data2), err, 50, ErrCorrupt)
+		}
+	}
+
+	o = &Options{BlockSize: 1000}
+	_, err = ioutil.ReadAll(NewReaderOptions(bytes.NewReader(nil), o))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("Got: %v, want: %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestSeekable(t *testing.T) {
+	data, err := ioutil.ReadFile("_test_files/wiki_huffman.html_")
+	if err != nil {
+		t.Error("Can't read input:", err)
+	}
+	data = data[:20000]
+
+	cases := []struct {
+		name string
+		data []byte
+		o    *Options
+	}{
+		{"Seekable [1000]", data, &Options{Seekable: true, BlockSize: 1000}},
+		{"Seekable [777,Static,Header]", data, &Options{Seekable: true, BlockSize: 777, Mode: ModeStatic, Header: true}},
+		{"Seekable [1000,FGK,Checksum,Conc=4]", data, &Options{Seekable: true, BlockSize: 1000, Mode: ModeFGK, Checksum: true, Concurrency: 4}},
+		{"Seekable [default]", data, &Options{Seekable: true}},
+		{"Seekable [empty]", nil, &Options{Seekable: true, BlockSize: 1000}},
+	}
+	for _, c := range cases {
+		// Seekable streams must be readable by Reader
+		testWriteAndRead(c.name, c.data, t, c.o)
+
+		buf := &bytes.Buffer{}
+		w := NewWriterOptions(buf, c.o)
+		w.Write(c.data)
+		w.Close()
+
+		ro := c.o
+		if c.o.Header {
+			ro = &Options{Header: true}
+		}
+		sr, err := NewSeekableReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), ro)
+		if err != nil {
+			t.Errorf("[%s] Failed to create SeekableReader: %v", c.name, err)
+			continue
+		}
+		if sr.Size() != int64(len(c.data)) {
+			t.Errorf("[%s] Got size: %d, want: %d", c.name, sr.Size(), len(c.data))
+		}
+
+		// Random access reads
+		for _, off := range []int{0, 1, 999, 1000, 1001, 5555, len(c.data) - 10, len(c.data)} {
+			if off < 0 || off > len(c.data) {
+				continue
+			}
+			p := make([]byte, 2500)
+			n, err := sr.ReadAt(p, int64(off))
+			want := c.data[off:]
+			if len(want) > len(p) {
+				want = want[:len(p)]
+			}
+			if n != len(want) || !bytes.Equal(p[:n], want) {
+				t.Errorf("[%s] ReadAt(%d) returned different data", c.name, off)
+			}
+			if n < len(p) && err != io.EOF {
+				t.Errorf("[%s] ReadAt(%d) got: %v, want: %v", c.name, off, err, io.EOF)
+			}
+		}
+
+		// Seek and Read
+		if _, err := sr.Seek(-int64(len(c.data)/3), io.SeekEnd); err != nil {
+			t.Errorf("[%s] Seek failed: %v", c.name, err)
+		}
+		data2, err := ioutil.ReadAll(sr)
+		if err != nil || !bytes.Equal(data2, c.data[len(c.data)-len(c.data)/3:]) {
+			t.Errorf("[%s] Read after Seek returned different data, error: %v", c.name, err)
+		}
+	}
+
+	// Streams without index
+	buf := &bytes.Buffer{}
+	w := NewWriterOptions(buf, &Options{BlockSize: 1000})
+	w.Write(data)
+	w.Close()
+	_, err = NewSeekableReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{BlockSize: 1000, Seekable: true})
+	if err != ErrNotSeekable {
+		t.Errorf("Got: %v, want: %v", err, ErrNotSeekable)
+	}
+	_, err = NewSeekableReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()), &Options{BlockSize: 1000})
+	if err != ErrNotSeekable {
+		t.Errorf("Got: %v, want: %v", err, ErrNotSeekable)
+	}
+
+	// Corrupted block: only reads touching it must fail
+	o := &Options{Seekable: true, BlockSize: 1000, Checksum: true}
+	buf.Reset()
+	w = NewWriterOptions(buf, o)
+	w.Write(data)
+	w.Close()
+	corrupted := append([]byte(nil), buf.Bytes()...)
+	corrupted[len(corrupted)/2] ^= 0x10
+	sr, err := NewSeekableReader(bytes.NewReader(corrupted), int64(len(corrupted)), o)
+	if err != nil {
+		t.Fatalf("Failed to create SeekableReader: %v", err)
+	}
+	p := make([]byte, 100)
+	if _, err = sr.ReadAt(p, 0); err != nil {
+		t.Errorf("Reading intact block failed: %v", err)
+	}
+	if _, err = ioutil.ReadAll(sr); err != ErrChecksum && err != ErrCorrupt {
+		t.Errorf("Got: %v, want: %v or %v", err, ErrChecksum, ErrCorrupt)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	// 16-bit tokens, skewed distribution
+	data := make([]huffman.ValueType, 5000)
+	for i := range data {
+		data[i] = huffman.ValueType(rand.Intn(rand.Intn(200)+1) * 321)
+	}
+
+	cases := []struct {
+		name string
+		data []huffman.ValueType
+		o    *Options
+	}{
+		{"Symbols [16]", data, &Options{LiteralBits: 16}},
+		{"Symbols [16,NoWin]", data, &Options{LiteralBits: 16, WinSize: -1}},
+		{"Symbols [16,FGK]", data, &Options{LiteralBits: 16, Mode: ModeFGK}},
+		{"Symbols [16,Static]", data, &Options{LiteralBits: 16, Mode: ModeStatic}},
+		{"Symbols [16,Header,Checksum]", data, &Options{LiteralBits: 16, Header: true, Checksum: true}},
+		{"Symbols [16,Blocks,Conc=4]", data, &Options{LiteralBits: 16, BlockSize: 1000, Concurrency: 4, Mode: ModeFGK}},
+		{"Symbols [30]", []huffman.ValueType{1<<30 - 1, 0, 1 << 29, 1<<30 - 1}, &Options{LiteralBits: 30, Checksum: true}},
+		{"Symbols [1]", []huffman.ValueType{0, 1, 1, 0, 1}, &Options{LiteralBits: 1, Mode: ModeStatic}},
+		{"Symbols [empty]", nil, &Options{LiteralBits: 12}},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		w := NewSymbolWriterOptions(buf, c.o)
+		for _, v := range c.data {
+			if err := w.WriteSymbol(v); err != nil {
+				t.Errorf("[%s] Failed to write: %v", c.name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Errorf("[%s] Failed to close: %v", c.name, err)
+		}
+
+		ro := c.o
+		if c.o.Header {
+			ro = &Options{Header: true}
+		}
+		r := NewSymbolReaderOptions(bytes.NewReader(buf.Bytes()), ro)
+		var data2 []huffman.ValueType
+		for {
+			v, err := r.ReadSymbol()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("[%s] Failed to read: %v", c.name, err)
+				}
+				break
+			}
+			data2 = append(data2, v)
+		}
+		if fmt.Sprint(c.data) != fmt.Sprint(data2) {
+			t.Errorf("[%s] Decoded doesn't match original!", c.name)
+		}
+	}
+
+	// Values out of the alphabet
+	w := NewSymbolWriterOptions(ioutil.Discard, &Options{LiteralBits: 4})
+	for _, v := range []huffman.ValueType{-1, 16, eofValue} {
+		if err := w.WriteSymbol(v); err != ErrValueRange {
+			t.Errorf("Got: %v, want: %v", err, ErrValueRange)
+		}
+	}
+	if _, err := NewWriterOptions(ioutil.Discard, &Options{LiteralBits: 7}).Write([]byte{200}); err != ErrValueRange {
+		t.Errorf("Got: %v, want: %v", err, ErrValueRange)
+	}
+
+	// Bytes written by a Writer must be readable by a SymbolReader and vice versa
+	buf := &bytes.Buffer{}
+	sw := NewSymbolWriter(buf)
+	sw.WriteSymbol('a')
+	sw.WriteSymbol('b')
+	sw.Close()
+	if data, err := ioutil.ReadAll(NewReader(bytes.NewReader(buf.Bytes()))); err != nil || string(data) != "ab" {
+		t.Errorf("Got: %q, %v, want: %q", data, err, "ab")
+	}
+
+	// Reader can't read values which are not bytes
+	o := &Options{LiteralBits: 9}
+	buf.Reset()
+	sw = NewSymbolWriterOptions(buf, o)
+	sw.WriteSymbol(300)
+	sw.Close()
+	if _, err := ioutil.ReadAll(NewReaderOptions(bytes.NewReader(buf.Bytes()), o)); err != ErrValueRange {
+		t.Errorf("Got: %v, want: %v", err, ErrValueRange)
+	}
+}
+
+func TestFlush(t *testing.T) {
+	msgs := []string{"hello", "", "hello world", "x", "the quick brown fox jumps over the lazy dog", "xxxxxxxx"}
+
+	cases := []struct {
+		name string
+		o    *Options
+	}{
+		{"Flush [Adaptive]", &Options{}},
+		{"Flush [WinSize=1]", &Options{WinSize: 1}},
+		{"Flush [WinSize=-1]", &Options{WinSize: -1}},
+		{"Flush [FGK]", &Options{Mode: ModeFGK}},
+		{"Flush [FGK,WinSize=1]", &Options{Mode: ModeFGK, WinSize: 1}},
+		{"Flush [Header,Checksum]", &Options{Header: true, Checksum: true}},
+		{"Flush [Blocks]", &Options{BlockSize: 16, Checksum: true}},
+		{"Flush [Blocks,Header,Conc=4]", &Options{BlockSize: 16, Header: true, Concurrency: 4}},
+		{"Flush [Static,Blocks,Conc=4]", &Options{Mode: ModeStatic, BlockSize: 16, Concurrency: 4}},
+	}
+	for _, c := range cases {
+		// The writer writes to a pipe, and waits until the reader decodes each message after flushing:
+		// the reader must not wait for more data.
+		pr, pw := io.Pipe()
+		watchdog := time.AfterFunc(10*time.Second, func() { pw.CloseWithError(errors.New("timeout")) })
+		ack := make(chan struct{})
+		go func() {
+			w := NewWriterOptions(pw, c.o)
+			for i, msg := range msgs {
+				if _, err := w.Write([]byte(msg)); err != nil {
+					t.Errorf("[%s] Failed to write: %v", c.name, err)
+				}
+				if err := w.Flush(); err != nil {
+					t.Errorf("[%s] Failed to flush: %v", c.name, err)
+				}
+				if i == 1 {
+					if err := w.Flush(); err != nil { // Subsequent flush
+						t.Errorf("[%s] Failed to flush: %v", c.name, err)
+					}
+				}
+				if msg != "" {
+					<-ack
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("[%s] Failed to close: %v", c.name, err)
+			}
+			pw.Close()
+		}()
+
+		ro := c.o
+		if c.o.Header {
+			ro = &Options{Header: true, Concurrency: c.o.Concurrency}
+		}
+		r := NewReaderOptions(pr, ro)
+		for _, msg := range msgs {
+			if msg == "" {
+				continue
+			}
+			p := make([]byte, 100)
+			n, err := io.ReadAtLeast(r, p, len(msg))
+			if err != nil || string(p[:n]) != msg {
+				t.Errorf("[%s] Got: %q, %v, want: %q", c.name, p[:n], err, msg)
+			}
+			ack <- struct{}{}
+		}
+		if data, err := ioutil.ReadAll(r); err != nil || len(data) > 0 {
+			t.Errorf("[%s] Got: %q, %v, want: EOF", c.name, data, err)
+		}
+		watchdog.Stop()
+	}
+
+	// Static mode without blocks can't be flushed
+	w := NewWriterOptions(ioutil.Discard, &Options{Mode: ModeStatic})
+	if err := w.Flush(); err != ErrFlush {
+		t.Errorf("Got: %v, want: %v", err, ErrFlush)
+	}
+}
+
+func TestReset(t *testing.T) {
+	msgs := [][]byte{
+		[]byte("first message, first message"),
+		nil,
+		[]byte("second"),
+		bytes.Repeat([]byte("abcdefgh"), 100),
+	}
+
+	cases := []struct {
+		name string
+		o    *Options
+	}{
+		{"Reset [Adaptive]", &Options{}},
+		{"Reset [WinSize=4]", &Options{WinSize: 4}},
+		{"Reset [FGK,Checksum]", &Options{Mode: ModeFGK, Checksum: true}},
+		{"Reset [Static,Header]", &Options{Mode: ModeStatic, Header: true}},
+		{"Reset [Blocks,Conc=4]", &Options{BlockSize: 100, Concurrency: 4, Header: true}},
+		{"Reset [Seekable]", &Options{Seekable: true, BlockSize: 300}},
+	}
+	for _, c := range cases {
+		var w *Writer
+		var r *Reader
+		for i, msg := range msgs {
+			// Output reused Writer must be identical to the output of a new Writer
+			buf, buf2 := &bytes.Buffer{}, &bytes.Buffer{}
+			w2 := NewWriterOptions(buf2, c.o)
+			if w == nil {
+				w = NewWriterOptions(struct{ io.Writer }{buf}, c.o) // Not an io.ByteWriter
+			} else {
+				w.Reset(struct{ io.Writer }{buf})
+			}
+			if i == 2 {
+				w.Write(msgs[3]) // To be discarded by Reset
+				w.Reset(struct{ io.Writer }{buf})
+			}
+			for _, ww := range []*Writer{w, w2} {
+				if _, err := ww.Write(msg); err != nil {
+					t.Errorf("[%s] Failed to write: %v", c.name, err)
+				}
+				if err := ww.Close(); err != nil {
+					t.Errorf("[%s] Failed to close: %v", c.name, err)
+				}
+			}
+			if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+				t.Errorf("[%s] Output of reset Writer differs", c.name)
+			}
+
+			in := struct{ io.Reader }{bytes.NewReader(buf.Bytes())} // Not an io.ByteReader
+			if r == nil {
+				r = NewReaderOptions(in, c.o)
+			} else {
+				r.Reset(in)
+			}
+			if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, msg) {
+				t.Errorf("[%s] Got: %q, %v, want: %q", c.name, data, err, msg)
+			}
+			if i == 2 {
+				r.Reset(bytes.NewReader(buf2.Bytes()))
+				if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, msg) {
+					t.Errorf("[%s] Got: %q, %v, want: %q", c.name, data, err, msg)
+				}
+				r.Reset(bytes.NewReader(buf.Bytes()[:len(buf.Bytes())/2])) // Truncated, read partially
+				r.ReadByte()
+			}
+		}
+	}
+
+	// Reset must not wait for frames being read ahead from a blocking source
+	o := &Options{BlockSize: 10, Concurrency: 4}
+	buf := &bytes.Buffer{}
+	w := NewWriterOptions(buf, o)
+	w.Write(msgs[0])
+	w.Close()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	size, n := binary.Uvarint(buf.Bytes())
+	go pw.Write(buf.Bytes()[:n+int(size)+2]) // Second frame is incomplete, then the source blocks
+	r := NewReaderOptions(pr, o)
+	if b, err := r.ReadByte(); err != nil || b != msgs[0][0] {
+		t.Errorf("Got: %q, %v, want: %q", b, err, msgs[0][0])
+	}
+	r.Reset(bytes.NewReader(buf.Bytes()))
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, msgs[0]) {
+		t.Errorf("Got: %q, %v, want: %q", data, err, msgs[0])
+	}
+}
+
+func TestDict(t *testing.T) {
+	// genMsg generates a message having a similar distribution as others.
+	genMsg := func() []byte {
+		msg := make([]byte, 50+rand.Intn(200))
+		for i := range msg {
+			msg[i] = "aaaaaaaabbbbccdeeeeeeeeee  ,.{}\"\":0123456789"[rand.Intn(44)]
+		}
+		return msg
+	}
+
+	h := &huffman.Histogram{}
+	for i := 0; i < 100; i++ {
+		h.Write(genMsg())
+	}
+	dict, err := TrainDict(h, 0)
+	if err != nil {
+		t.Fatalf("Failed to train: %v", err)
+	}
+	if n := len(dict.Counts()); n != 22 {
+		t.Errorf("Got %d values, want: %d", n, 22)
+	}
+
+	cases := []struct {
+		name string
+		o    *Options
+	}{
+		{"Dict [Adaptive]", &Options{Dict: dict}},
+		{"Dict [WinSize=-1]", &Options{Dict: dict, WinSize: -1}},
+		{"Dict [WinSize=1]", &Options{Dict: dict, WinSize: 1}},
+		{"Dict [FGK]", &Options{Dict: dict, Mode: ModeFGK}},
+		{"Dict [FGK,WinSize=10]", &Options{Dict: dict, Mode: ModeFGK, WinSize: 10}},
+		{"Dict [Header,Checksum]", &Options{Dict: dict, Header: true, Checksum: true}},
+		{"Dict [Blocks,Conc=2]", &Options{Dict: dict, BlockSize: 50, Concurrency: 2}},
+		{"Dict [Static]", &Options{Dict: dict, Mode: ModeStatic}},
+	}
+	for _, c := range cases {
+		for i := 0; i < 5; i++ {
+			msg := genMsg()
+			if i == 0 {
+				msg = append(msg, "xyz"...) // Values not in the dictionary
+			}
+			buf, buf2 := &bytes.Buffer{}, &bytes.Buffer{}
+			o2 := *c.o
+			o2.Dict = nil
+			for _, x := range []struct {
+				buf *bytes.Buffer
+				o   *Options
+			}{{buf, c.o}, {buf2, &o2}} {
+				w := NewWriterOptions(x.buf, x.o)
+				w.Write(msg)
+				if err := w.Close(); err != nil {
+					t.Errorf("[%s] Failed to close: %v", c.name, err)
+				}
+			}
+			if c.o.Mode == ModeStatic && buf.Len() != buf2.Len() || c.o.Mode != ModeStatic && buf.Len() >= buf2.Len() {
+				t.Errorf("[%s] Unexpected size with dictionary: %d, without: %d", c.name, buf.Len(), buf2.Len())
+			}
+
+			r := NewReaderOptions(bytes.NewReader(buf.Bytes()), c.o)
+			if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, msg) {
+				t.Errorf("[%s] Got: %q, %v, want: %q", c.name, data, err, msg)
+			}
+		}
+	}
+
+	// Reader must have the same dictionary
+	buf := &bytes.Buffer{}
+	w := NewWriterOptions(buf, &Options{Dict: dict, Header: true})
+	w.Write(genMsg())
+	w.Close()
+	dict2, _ := NewDict(map[huffman.ValueType]int{'a': 1})
+	for _, d := range []*Dict{nil, dict2} {
+		r := NewReaderOptions(bytes.NewReader(buf.Bytes()), &Options{Header: true, Dict: d})
+		if _, err := ioutil.ReadAll(r); err != ErrDict {
+			t.Errorf("Got: %v, want: %v", err, ErrDict)
+		}
+	}
+	// Stream without dictionary can be read by a Reader having one
+	buf.Reset()
+	w = NewWriterOptions(buf, &Options{Header: true})
+	w.Write([]byte("abc"))
+	w.Close()
+	r := NewReaderOptions(bytes.NewReader(buf.Bytes()), &Options{Header: true, Dict: dict})
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "abc" {
+		t.Errorf("Got: %q, %v, want: %q", data, err, "abc")
+	}
+
+	// Symbols
+	sdict, err := NewDict(map[huffman.ValueType]int{1000: 5, 2000: 3, 1 << 20: 1, 0: 0})
+	if err != nil {
+		t.Fatalf("Failed to create dictionary: %v", err)
+	}
+	values := []huffman.ValueType{1000, 1000, 2000, 3000, 1000}
+	buf.Reset()
+	sw := NewSymbolWriterOptions(buf, &Options{Dict: sdict, LiteralBits: 12})
+	for _, v := range values {
+		sw.WriteSymbol(v)
+	}
+	sw.Close()
+	sr := NewSymbolReaderOptions(bytes.NewReader(buf.Bytes()), &Options{Dict: sdict, LiteralBits: 12})
+	for _, v := range values {
+		if v2, err := sr.ReadSymbol(); err != nil || v2 != v {
+			t.Errorf("Got: %d, %v, want: %d", v2, err, v)
+		}
+	}
+	if _, err := NewDict(map[huffman.ValueType]int{-1: 1}); err != ErrValueRange {
+		t.Errorf("Got: %v, want: %v", err, ErrValueRange)
+	}
+
+	// Serialization
+	data, err := dict.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	dict3 := &Dict{}
+	if err := dict3.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if dict3.ID() != dict.ID() || fmt.Sprint(dict3.Counts()) != fmt.Sprint(dict.Counts()) {
+		t.Errorf("Unmarshaled dictionary differs")
+	}
+	for _, data := range [][]byte{nil, {2}, {1, 1, 0}, {1, 1, 5, 0}, {1, 2, 5, 1, 0, 1}, data[:len(data)-1], append(data, 0)} {
+		if err := (&Dict{}).UnmarshalBinary(data); err != ErrInvalidDict {
+			t.Errorf("[%v] Got: %v, want: %v", data, err, ErrInvalidDict)
+		}
+	}
+}
+
 type errReader struct {
 	data []byte // Data to simulate before reporting error
 }
@@ -0,0 +1,297 @@
+/*
+
+Seekable stream implementation: block index and random access reader.
+
+*/
+
+package hufio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
+)
+
+// indexMagic is the magic bytes the footer of a seekable stream ends with.
+var indexMagic = []byte("HUFI")
+
+// footerSize is the size of the footer: size of the index (4 bytes) and indexMagic.
+const footerSize = 8
+
+var (
+	// ErrNotSeekable is returned by NewSeekableReader if the stream does not have a block index.
+	ErrNotSeekable = errors.New("hufio: stream is not seekable")
+
+	// errNegativeOffset is returned if seeking to or reading at a negative offset is attempted.
+	errNegativeOffset = errors.New("hufio: negative offset")
+)
+
+// blockIndex is the index of blocks in a seekable stream.
+//
+// The index is written after the end frame: the offset of the first frame, the number of blocks,
+// and the uncompressed and frame sizes of each block (all uvarint encoded),
+// followed by the footer: the size of the index (4 bytes, big endian) and indexMagic.
+type blockIndex struct {
+	start  int64       // Offset of the first frame in the stream
+	blocks []indexItem // Items of the blocks
+}
+
+// reset empties the index.
+func (bi *blockIndex) reset() {
+	bi.start, bi.blocks = 0, bi.blocks[:0]
+}
+
+// indexItem is an item of the block index.
+type indexItem struct {
+	size      int   // Size of the uncompressed data
+	frameSize int   // Size of the frame
+	offset    int64 // Offset of the uncompressed data
+	frameOff  int64 // Offset of the frame in the stream
+}
+
+// add adds a new block to the index.
+func (bi *blockIndex) add(size, frameSize int) {
+	item := indexItem{size: size, frameSize: frameSize, frameOff: bi.start}
+	if n := len(bi.blocks); n > 0 {
+		last := bi.blocks[n-1]
+		item.offset = last.offset + int64(last.size)
+		item.frameOff = last.frameOff + int64(last.frameSize)
+	}
+	bi.blocks = append(bi.blocks, item)
+}
+
+// write writes the index and the footer.
+func (bi *blockIndex) write(bw *bitio.Writer) error {
+	data := appendUvarint(nil, uint64(bi.start))
+	data = appendUvarint(data, uint64(len(bi.blocks)))
+	for _, item := range bi.blocks {
+		data = appendUvarint(data, uint64(item.size))
+		data = appendUvarint(data, uint64(item.frameSize))
+	}
+
+	footer := make([]byte, 4, footerSize)
+	binary.BigEndian.PutUint32(footer, uint32(len(data)))
+	data = append(data, append(footer, indexMagic...)...)
+
+	_, err := bw.Write(data)
+	return err
+}
+
+// readIndex reads the block index of a seekable stream of the specified size.
+func readIndex(ra io.ReaderAt, size int64, o *Options) (*blockIndex, error) {
+	footer := make([]byte, footerSize)
+	if size < footerSize {
+		return nil, ErrNotSeekable
+	}
+	if _, err := ra.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(footer[4:], indexMagic) {
+		return nil, ErrNotSeekable
+	}
+
+	indexSize := int64(binary.BigEndian.Uint32(footer))
+	if indexSize > size-footerSize {
+		return nil, ErrCorrupt
+	}
+	data := make([]byte, indexSize)
+	if _, err := ra.ReadAt(data, size-footerSize-indexSize); err != nil {
+		return nil, err
+	}
+
+	// next returns the next uvarint from data.
+	var err error
+	next := func() int64 {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > 1<<62 {
+			err = ErrCorrupt
+			return 0
+		}
+		data = data[n:]
+		return int64(v)
+	}
+
+	bi := &blockIndex{start: next()}
+	count := next()
+	if err != nil || count > int64(len(data)) {
+		return nil, ErrCorrupt
+	}
+	for i := int64(0); i < count; i++ {
+		blockSize, frameSize := next(), next()
+		if err != nil || blockSize <= 0 || blockSize > int64(o.BlockSize) ||
+			frameSize <= 0 || frameSize > maxFrameSize(o)+binary.MaxVarintLen64 {
+			return nil, ErrCorrupt
+		}
+		bi.add(int(blockSize), int(frameSize))
+	}
+	if len(data) > 0 {
+		return nil, ErrCorrupt
+	}
+	if n := len(bi.blocks); n > 0 {
+		if last := bi.blocks[n-1]; last.frameOff+int64(last.frameSize) > size-footerSize-indexSize {
+			return nil, ErrCorrupt
+		}
+	}
+
+	return bi, nil
+}
+
+// SeekableReader provides random access to the uncompressed data of a seekable stream
+// (written by a Writer with Options.Seekable set).
+// Only the blocks containing the requested data are read and decoded.
+//
+// SeekableReader implements io.ReadSeeker and io.ReaderAt.
+// ReadAt may be called concurrently, but Read and Seek must not.
+type SeekableReader struct {
+	ra    io.ReaderAt
+	o     *Options
+	index *blockIndex
+	size  int64 // Size of the uncompressed data
+	pos   int64 // Current position for Read and Seek
+
+	mu    sync.Mutex // Protects the cached block
+	cache int        // Index of the cached decoded block, -1 if none
+	block []byte     // Cached decoded block
+}
+
+// NewSeekableReader returns a new SeekableReader which reads the seekable stream
+// of the specified size from ra, with the specified Options.
+//
+// If Options.Header is true, the Options are read from the stream header.
+// Else Options must be the same as the Writer's Options were.
+//
+// ErrNotSeekable is returned if the stream does not have a block index.
+func NewSeekableReader(ra io.ReaderAt, size int64, o *Options) (*SeekableReader, error) {
+	o = checkOptions(o)
+	if o.Header {
+		var err error
+		if o, err = readHeader(huffman.NewBitReader(io.NewSectionReader(ra, 0, size)), o.Dict); err != nil {
+			return nil, err
+		}
+	}
+	if !o.Seekable {
+		return nil, ErrNotSeekable
+	}
+
+	index, err := readIndex(ra, size, o)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := &SeekableReader{ra: ra, o: o, index: index, cache: -1}
+	if n := len(index.blocks); n > 0 {
+		last := index.blocks[n-1]
+		sr.size = last.offset + int64(last.size)
+	}
+	return sr, nil
+}
+
+// Size returns the size of the uncompressed data.
+func (sr *SeekableReader) Size() int64 {
+	return sr.size
+}
+
+// Read reads up to len(p) bytes of the uncompressed data from the current position.
+//
+// Read implements io.Reader.
+func (sr *SeekableReader) Read(p []byte) (n int, err error) {
+	n, err = sr.ReadAt(p, sr.pos)
+	sr.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+// Seek sets the position for the next Read.
+//
+// Seek implements io.Seeker.
+func (sr *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.pos
+	case io.SeekEnd:
+		offset += sr.size
+	default:
+		return 0, errors.New("hufio: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	sr.pos = offset
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes of the uncompressed data starting at offset off.
+//
+// ReadAt implements io.ReaderAt.
+func (sr *SeekableReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errNegativeOffset
+	}
+
+	blocks := sr.index.blocks
+	// Index of the block containing off:
+	i := sort.Search(len(blocks), func(i int) bool { return blocks[i].offset+int64(blocks[i].size) > off })
+	for ; n < len(p) && i < len(blocks); i++ {
+		var data []byte
+		if data, err = sr.readBlock(i); err != nil {
+			return
+		}
+		k := copy(p[n:], data[off+int64(n)-blocks[i].offset:])
+		n += k
+	}
+
+	if n < len(p) {
+		err = io.EOF
+	}
+	return
+}
+
+// readBlock returns the decoded data of the ith block.
+func (sr *SeekableReader) readBlock(i int) ([]byte, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.cache == i {
+		return sr.block, nil
+	}
+
+	item := sr.index.blocks[i]
+	frame := make([]byte, item.frameSize)
+	if _, err := sr.ra.ReadAt(frame, item.frameOff); err != nil {
+		return nil, unexpectedEOF(err, sr.o)
+	}
+
+	segment, err := readFrame(huffman.NewBitReader(bytes.NewReader(frame)), sr.o)
+	if err != nil {
+		if err == io.EOF {
+			err = ErrCorrupt // Not an end frame
+		}
+		return nil, err
+	}
+	values, err := decodeBlock(segment, sr.o)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != item.size {
+		return nil, ErrCorrupt
+	}
+	data := make([]byte, len(values))
+	for i, v := range values {
+		if v > 255 {
+			return nil, ErrValueRange
+		}
+		data[i] = byte(v)
+	}
+
+	sr.cache, sr.block = i, data
+	return data, nil
+}
@@ -0,0 +1,107 @@
+/*
+
+Static (two-pass) coding implementation.
+
+*/
+
+package hufio
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/icza/bitio"
+	"github.com/icza/huffman"
+)
+
+// maxStaticBits is the max length of the codes used in static mode.
+const maxStaticBits = 32
+
+// maxTableSize returns the max size of the serialized code table in static mode:
+// version, number of codes, and max values with value diff and code length.
+// The number of values is limited by the alphabet (see Options.LiteralBits), and by the block size in block mode.
+func maxTableSize(o *Options) int64 {
+	values := int64(1) << uint(o.LiteralBits)
+	if o.BlockSize > 0 && int64(o.BlockSize) < values {
+		values = int64(o.BlockSize)
+	}
+	return 1 + binary.MaxVarintLen64 + (values+extraValues)*(binary.MaxVarintLen64+1)
+}
+
+// writeStatic writes the code table of the data and the encoded data itself, followed by eofValue.
+// Data of the byte alphabet may be passed as []byte, which takes less memory.
+func writeStatic[T byte | huffman.ValueType](bw *bitio.Writer, data []T) (err error) {
+	counts := make(map[huffman.ValueType]int, byteValues)
+	for _, v := range data {
+		counts[huffman.ValueType(v)]++
+	}
+
+	leaves := make([]*huffman.Node, 0, len(counts)+1)
+	for v, count := range counts {
+		leaves = append(leaves, &huffman.Node{Value: v, Count: count})
+	}
+	// Sort by value for deterministic output (map iteration order is random)
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].Value < leaves[j].Value })
+	leaves = append(leaves, &huffman.Node{Value: eofValue, Count: 1})
+
+	root, err := huffman.BuildLimited(leaves, maxStaticBits)
+	if err != nil {
+		return
+	}
+	table, err := huffman.NewTableCodes(huffman.CanonicalTree(root))
+	if err != nil {
+		return
+	}
+
+	// Code table, prefixed with its size
+	tableData, err := table.MarshalBinary()
+	if err != nil {
+		return
+	}
+	var buf [binary.MaxVarintLen64]byte
+	if _, err = bw.Write(buf[:binary.PutUvarint(buf[:], uint64(len(tableData)))]); err != nil {
+		return
+	}
+	if _, err = bw.Write(tableData); err != nil {
+		return
+	}
+
+	// Encoded data
+	for _, v := range data {
+		r, bits, _ := table.Encode(huffman.ValueType(v))
+		if err = bw.WriteBits(r, bits); err != nil {
+			return
+		}
+	}
+	r, bits, _ := table.Encode(eofValue)
+	return bw.WriteBits(r, bits)
+}
+
+// readStaticTable reads the code table written by writeStatic().
+// The returned Table decodes using multi-level lookup tables.
+func readStaticTable(br *huffman.BitReader, o *Options) (table *huffman.Table, err error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return
+	}
+	if size > uint64(maxTableSize(o)) {
+		return nil, ErrCorrupt
+	}
+
+	// Size may be large for big alphabets, don't allocate it before the data arrives:
+	tableData, err := ioutil.ReadAll(io.LimitReader(br, int64(size)))
+	if err != nil {
+		return
+	}
+	if uint64(len(tableData)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	table = &huffman.Table{}
+	if err = table.UnmarshalBinary(tableData); err != nil {
+		return nil, ErrCorrupt
+	}
+	return
+}
@@ -0,0 +1,100 @@
+/*
+
+Symbol Writer and Reader implementation: coding symbols of arbitrary alphabets.
+
+*/
+
+package hufio
+
+import (
+	"errors"
+	"io"
+
+	"github.com/icza/huffman"
+)
+
+// ErrValueRange is returned if a value is not in the alphabet:
+// if a written symbol is not in the range specified by Options.LiteralBits,
+// or if Reader reads a value which is not a byte.
+var ErrValueRange = errors.New("hufio: value out of range")
+
+// validValue tells if the value v is in the alphabet specified by Options.LiteralBits.
+func validValue(v huffman.ValueType, o *Options) bool {
+	return v >= 0 && v < 1<<uint(o.LiteralBits)
+}
+
+// SymbolWriter is a Huffman writer which writes symbols of an arbitrary alphabet,
+// for example 16-bit tokens or word IDs. The alphabet is specified by Options.LiteralBits.
+// Must be closed in order to properly send EOF.
+//
+// SymbolWriter supports all the modes and options of Writer.
+type SymbolWriter struct {
+	w *Writer
+}
+
+// NewSymbolWriter returns a new SymbolWriter using the specified io.Writer as the output,
+// with the default Options (which means the byte alphabet).
+func NewSymbolWriter(out io.Writer) *SymbolWriter {
+	return NewSymbolWriterOptions(out, nil)
+}
+
+// NewSymbolWriterOptions returns a new SymbolWriter using the specified io.Writer as the output,
+// with the specified Options.
+func NewSymbolWriterOptions(out io.Writer, o *Options) *SymbolWriter {
+	return &SymbolWriter{w: NewWriterOptions(out, o)}
+}
+
+// WriteSymbol writes the compressed form of the symbol v to the underlying io.Writer.
+// ErrValueRange is returned if v is not in the range [0, 1<<Options.LiteralBits).
+// The compressed byte(s) are not necessarily flushed until the SymbolWriter is flushed or closed.
+func (sw *SymbolWriter) WriteSymbol(v huffman.ValueType) error {
+	return sw.w.writeValue(v)
+}
+
+// Flush writes a sync point, see Writer.Flush().
+func (sw *SymbolWriter) Flush() error {
+	return sw.w.Flush()
+}
+
+// Close closes the Huffman writer, properly sending EOF.
+// If the underlying io.Writer implements io.Closer,
+// it will be closed after sending EOF.
+func (sw *SymbolWriter) Close() error {
+	return sw.w.Close()
+}
+
+// Reset discards the state of the SymbolWriter and makes it write to out, see Writer.Reset().
+func (sw *SymbolWriter) Reset(out io.Writer) {
+	sw.w.Reset(out)
+}
+
+// SymbolReader is a Huffman reader which reads symbols written by a SymbolWriter.
+type SymbolReader struct {
+	r *Reader
+}
+
+// NewSymbolReader returns a new SymbolReader using the specified io.Reader as the input (source),
+// with the default Options (which means the byte alphabet).
+func NewSymbolReader(in io.Reader) *SymbolReader {
+	return NewSymbolReaderOptions(in, nil)
+}
+
+// NewSymbolReaderOptions returns a new SymbolReader using the specified io.Reader as the input (source)
+// with the specified Options.
+//
+// Note: Options are only transmitted if Options.Header is true! Else the SymbolReader must use
+// the same Options as the SymbolWriter did.
+func NewSymbolReaderOptions(in io.Reader, o *Options) *SymbolReader {
+	return &SymbolReader{r: NewReaderOptions(in, o)}
+}
+
+// ReadSymbol decompresses a single symbol.
+// io.EOF is returned if there are no more symbols.
+func (sr *SymbolReader) ReadSymbol() (huffman.ValueType, error) {
+	return sr.r.readValue()
+}
+
+// Reset discards the state of the SymbolReader and makes it read from in, see Reader.Reset().
+func (sr *SymbolReader) Reset(in io.Reader) {
+	sr.r.Reset(in)
+}
@@ -7,37 +7,71 @@ Symbol table implementation.
 package hufio
 
 import (
-	"github.com/icza/huffman"
 	"sort"
+
+	"github.com/icza/huffman"
 )
 
 const (
 	newValue    huffman.ValueType   = 1<<31 - 1 - iota // Value representing a new value
 	eofValue                                           // Value representing end of data
 	extraValues = iota                                 // Number of extra, custom values
-	maxValues   = 256 + extraValues                    // Max values: number of bytes + extra values
+	byteValues  = 256 + extraValues                    // Number of bytes + extra values, initial capacity of symbol tables
 )
 
 // win is a sliding window buffer, the base of the symbol table.
+//
+// The buffer grows as symbols are stored (up to the size of the window),
+// so a huge window size (e.g. read from a corrupted stream header) does not allocate memory up front.
 type win struct {
 	buf    []huffman.ValueType // Content of the window buffer
+	size   int                 // Size of the window
 	pos    int                 // Position in the buffer
 	filled bool                // Tells if the buffer has been filled
 }
 
+// newWin creates a new win of the specified size.
+func newWin(size int) *win {
+	initSize := size
+	if initSize > byteValues {
+		initSize = byteValues
+	}
+	return &win{buf: make([]huffman.ValueType, 0, initSize), size: size}
+}
+
 // store stores the next symbol, and slides the window if it is already filled.
 func (w *win) store(symbol huffman.ValueType) {
+	if !w.filled {
+		w.buf = append(w.buf, symbol)
+		w.filled = len(w.buf) == w.size
+		return
+	}
+
 	w.buf[w.pos] = symbol
 	w.pos++
 	if w.pos == len(w.buf) {
 		w.pos = 0
-		if !w.filled {
-			w.filled = true
-		}
 	}
 }
 
+// leaving returns the symbol that shifts out of the window when the next symbol is stored.
+// ok is false if the window is not yet filled (no symbol shifts out).
+func (w *win) leaving() (symbol huffman.ValueType, ok bool) {
+	if !w.filled {
+		return
+	}
+	return w.buf[w.pos], true
+}
+
+// reset empties the window.
+func (w *win) reset() {
+	w.buf, w.pos, w.filled = w.buf[:0], 0, false
+}
+
 // symbols manages the symbol table and their frequencies.
+// The Huffman tree is rebuilt after each symbol.
+//
+// symbols implements model.
 type symbols struct {
 	// leaves of the Huffman tree, symbols previously encountered.
 	// Kept sorted by Node.Count, descendant (so new nodes can simply be appended)!
@@ -50,29 +84,80 @@ type symbols struct {
 	valueMap map[huffman.ValueType]*huffman.Node // Map from value to Node
 
 	win *win // The window buffer, nil if no window buffer is used
+
+	dict []huffman.Node // Leaves of the dictionary seeding the symbol table (see Options.Dict)
 }
 
 // newSymbols creates a new symbols.
 func newSymbols(o *Options) *symbols {
-	// initial leaves: 2 nodes (newValue and eofValue) with count=1, and a high capacity
-	leaves := make([]*huffman.Node, extraValues, maxValues)
-	leaves[0] = &huffman.Node{Value: newValue, Count: 1}
-	leaves[1] = &huffman.Node{Value: eofValue, Count: 1}
+	s := &symbols{
+		leaves:   make([]*huffman.Node, 0, byteValues), // high capacity
+		valueMap: make(map[huffman.ValueType]*huffman.Node, byteValues),
+		buffer:   make([]*huffman.Node, 0, byteValues),
+	}
+	if o.WinSize > 0 {
+		s.win = newWin(o.WinSize)
+	}
+	if o.Dict != nil {
+		s.dict = o.Dict.seed(o)
+	}
 
-	valueMap := make(map[huffman.ValueType]*huffman.Node, cap(leaves))
-	for _, v := range leaves {
-		valueMap[v.Value] = v
+	s.reset()
+
+	return s
+}
+
+// reset resets the symbol table to its initial state, keeping the allocated buffers.
+func (s *symbols) reset() {
+	// initial leaves: the leaves of the dictionary (they are sorted by count descendant),
+	// and 2 nodes (newValue and eofValue) with count=1
+	s.leaves = s.leaves[:0]
+	for _, l := range s.dict {
+		s.leaves = append(s.leaves, &huffman.Node{Value: l.Value, Count: l.Count})
 	}
+	s.leaves = append(s.leaves, &huffman.Node{Value: newValue, Count: 1}, &huffman.Node{Value: eofValue, Count: 1})
 
-	s := &symbols{leaves: leaves, valueMap: valueMap, buffer: make([]*huffman.Node, 0, maxValues)}
-	if o.WinSize > 0 {
-		s.win = &win{buf: make([]huffman.ValueType, o.WinSize)}
+	for v := range s.valueMap {
+		delete(s.valueMap, v)
+	}
+	for _, v := range s.leaves {
+		s.valueMap[v.Value] = v
+	}
+
+	if s.win != nil {
+		s.win.reset()
 	}
 
 	// Reader needs the Huffman tree ready right away, so build it:
 	s.rebuildTree()
+}
 
-	return s
+// code returns the Huffman code of the specified value, ok is false if the value is unknown.
+func (s *symbols) code(value huffman.ValueType) (r uint64, bits byte, ok bool) {
+	node := s.valueMap[value]
+	if node == nil {
+		return
+	}
+	r, bits = node.Code()
+	return r, bits, true
+}
+
+// decode reads a Huffman code and returns the value it denotes.
+func (s *symbols) decode(br *huffman.BitReader) (value huffman.ValueType, err error) {
+	node, err := readLeaf(br, s.root)
+	if err != nil {
+		return
+	}
+	return node.Value, nil
+}
+
+// add updates the symbol table with an occurrence of the specified value.
+func (s *symbols) add(value huffman.ValueType) {
+	if node := s.valueMap[value]; node != nil {
+		s.update(node)
+	} else {
+		s.insert(value)
+	}
 }
 
 // update updates the symbol table by incrementing the occurrence count of the specified Node.
@@ -107,9 +192,9 @@ func (s *symbols) updateWin(symbol huffman.ValueType) {
 		return
 	}
 
-	if s.win.filled {
+	if out, ok := s.win.leaving(); ok {
 		// Handle symbol shifting out of the window buffer:
-		node := s.valueMap[s.win.buf[s.win.pos]]
+		node := s.valueMap[out]
 		// We have to keep leaves sorted!
 		// So first find node in the leaves slice using binary search
 		// (remember: leaves is sorted by Node.Count descendant)
@@ -149,9 +234,8 @@ func (s *symbols) insert(symbol huffman.ValueType) {
 	node := &huffman.Node{Value: symbol, Count: 1}
 	// leaves is sorted descendant, so we could simply append.
 	// But extra values are at the end never increase, so we insert before them:
-	ls := s.leaves
 	// extend by 1 for the new node
-	ls = ls[:len(ls)+1]
+	ls := append(s.leaves, nil)
 	// Copy extra values to the end (higher by 1)
 	copy(ls[len(ls)-extraValues:], ls[len(ls)-extraValues-1:])
 	// And insert the new node
@@ -167,9 +251,12 @@ func (s *symbols) insert(symbol huffman.ValueType) {
 
 // rebuildTree rebuilds the Huffman tree.
 func (s *symbols) rebuildTree() {
-	// huffman.BuildSorted() modifies the slice, so make a copy:
-	// leaves is sorted descendant, so fill backward:
+	// huffman.BuildSorted() needs the leaves in ascending order,
+	// leaves is sorted descendant, so fill a buffer backward:
 	j := len(s.leaves)
+	if cap(s.buffer) < j {
+		s.buffer = make([]*huffman.Node, 0, cap(s.leaves))
+	}
 	ls := s.buffer[:j]
 	for _, v := range s.leaves {
 		j--
@@ -7,17 +7,37 @@ Huffman code Writer implementation.
 package hufio
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"io"
 
 	"github.com/icza/bitio"
 	"github.com/icza/huffman"
 )
 
+// ErrFlush is returned by Writer.Flush() in static mode (without blocks), which can't be flushed.
+var ErrFlush = errors.New("hufio: static mode can't be flushed")
+
 // Writer is the Huffman writer implementation.
 // Must be closed in order to properly send EOF.
+//
+// In static mode (see ModeStatic) data is buffered, and it is only encoded and written when the Writer is closed
+// (or when a block is completed in block mode, see Options.BlockSize).
 type Writer struct {
-	*symbols
-	bw *bitio.Writer
+	bw      *bitio.Writer
+	o       *Options
+	buf     *bufio.Writer // Buffer wrapping the output if it does not implement io.ByteWriter (kept for reuse)
+	wrapped bool          // Tells if the output is wrapped in buf
+
+	header  bool                  // Tells if the stream header is yet to be written
+	enc     *encoder              // Encoder of the data, nil in block mode
+	block   []huffman.ValueType   // Buffered data of the current block in block mode
+	pending []chan *blockResult   // Blocks being encoded concurrently, in order
+	free    [][]huffman.ValueType // Block buffers free for reuse
+	index   *blockIndex           // Block index if Options.Seekable
+	frames  uint64                // Number of frames written in block mode
+	size    uint64                // Total size of the encoded segments written in block mode
 }
 
 // NewWriter returns a new Writer using the specified io.Writer as the output,
@@ -29,19 +49,81 @@ func NewWriter(out io.Writer) *Writer {
 // NewWriterOptions returns a new Writer using the specified io.Writer as the output,
 // with the specified Options.
 //
-// Note: Options are not transmitted internally! The Reader will only be able to properly decode the stream
-// created by a Writer if the same Options is used both at the Reader and Writer.
-// Transmitting the Options has to be done manually if needed.
+// Note: Options are only transmitted if Options.Header is true! Else the Reader will only be able to
+// properly decode the stream created by a Writer if the same Options is used both at the Reader and Writer.
 func NewWriterOptions(out io.Writer, o *Options) *Writer {
 	o = checkOptions(o)
-	return &Writer{symbols: newSymbols(o), bw: bitio.NewWriter(out)}
+	w := &Writer{o: o, header: o.Header}
+	w.setOutput(out)
+	if o.BlockSize > 0 {
+		w.block = make([]huffman.ValueType, 0, o.BlockSize)
+		if o.Seekable {
+			w.index = &blockIndex{}
+		}
+	} else {
+		w.enc = newEncoder(w.bw, o)
+	}
+	return w
+}
+
+// Reset discards the state of the Writer and makes it equivalent to the result of
+// NewWriterOptions() with the specified output and the original Options,
+// but the allocated buffers (symbol table, block buffers) are reused.
+// Data not yet flushed is discarded.
+//
+// Reset allows reusing Writers (e.g. with sync.Pool) to compress many small streams.
+func (w *Writer) Reset(out io.Writer) {
+	// Wait for blocks being encoded, so their buffers can be reused:
+	for _, ch := range w.pending {
+		res := <-ch
+		w.free = append(w.free, res.values[:0])
+	}
+	w.pending = w.pending[:0]
+
+	w.setOutput(out)
+	w.header = w.o.Header
+	w.frames, w.size = 0, 0
+	if w.enc != nil {
+		w.enc.reset(w.bw)
+	} else {
+		w.block = w.block[:0]
+		if w.index != nil {
+			w.index.reset()
+		}
+	}
+}
+
+// setOutput sets the output of the Writer.
+// If it does not implement io.ByteWriter, it is wrapped in a (reused) bufio.Writer.
+func (w *Writer) setOutput(out io.Writer) {
+	_, ok := out.(io.ByteWriter)
+	if w.wrapped = !ok; w.wrapped {
+		if w.buf == nil {
+			w.buf = bufio.NewWriter(out)
+		} else {
+			w.buf.Reset(out)
+		}
+		out = w.buf
+	}
+	w.bw = bitio.NewWriter(out)
+}
+
+// align aligns the output to a byte boundary, and flushes the buffered data.
+func (w *Writer) align() error {
+	if _, err := w.bw.Align(); err != nil {
+		return err
+	}
+	if w.wrapped {
+		return w.buf.Flush()
+	}
+	return nil
 }
 
 // Write writes the compressed form of p to the underlying io.Writer.
-// The compressed byte(s) are not necessarily flushed until the Writer is closed.
+// The compressed byte(s) are not necessarily flushed until the Writer is flushed or closed.
 func (w *Writer) Write(p []byte) (n int, err error) {
-	for i, v := range p {
-		if err = w.WriteByte(v); err != nil {
+	for i, b := range p {
+		if err = w.writeValue(huffman.ValueType(b)); err != nil {
 			return i, err
 		}
 	}
@@ -49,41 +131,288 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 }
 
 // WriteByte writes the compressed form of b to the underlying io.Writer.
-// The compressed byte(s) are not necessarily flushed until the Writer is closed.
-func (w *Writer) WriteByte(b byte) (err error) {
-	value := huffman.ValueType(b)
-	node := w.valueMap[value]
+// The compressed byte(s) are not necessarily flushed until the Writer is flushed or closed.
+func (w *Writer) WriteByte(b byte) error {
+	return w.writeValue(huffman.ValueType(b))
+}
 
-	if node == nil {
-		// New value, write out newValue's Huffman code
-		if err = w.bw.WriteBits(w.valueMap[newValue].Code()); err != nil {
+// writeValue writes the compressed form of the value v.
+// ErrValueRange is returned if v is not in the alphabet (see Options.LiteralBits).
+func (w *Writer) writeValue(v huffman.ValueType) (err error) {
+	if w.header {
+		if err = w.writeHeader(); err != nil {
 			return
 		}
-		// ...and the new value
-		if err = w.bw.WriteByte(b); err != nil {
+	}
+	if w.enc != nil {
+		return w.enc.writeValue(v)
+	}
+
+	if !validValue(v, w.o) {
+		return ErrValueRange
+	}
+	w.block = append(w.block, v)
+	if len(w.block) == w.o.BlockSize {
+		return w.writeBlock()
+	}
+	return nil
+}
+
+// Flush writes a sync point: all data written so far is emitted (including pending bits),
+// so a Reader on the other end can decode it, without ending the stream.
+// If the underlying io.Writer is buffered, it has to be flushed separately.
+//
+// In adaptive modes a sync marker is written (the code of a new value followed by the value of an already
+// known one, which is never written otherwise), and the stream is aligned to a byte boundary.
+// In block mode the current block is ended (and all pending blocks are written).
+// ErrFlush is returned in static mode (without blocks), where data can only be encoded once all is known.
+func (w *Writer) Flush() (err error) {
+	if w.header {
+		if err = w.writeHeader(); err != nil {
 			return
 		}
-		w.insert(value)
-	} else {
-		// Write out node's Huffman code
-		if err = w.bw.WriteBits(node.Code()); err != nil {
+	}
+
+	if w.enc != nil {
+		if err = w.enc.flush(); err != nil {
 			return
 		}
-		w.update(node)
+	} else {
+		if len(w.block) > 0 {
+			if err = w.writeBlock(); err != nil {
+				return
+			}
+		}
+		for len(w.pending) > 0 {
+			if err = w.writePending(); err != nil {
+				return
+			}
+		}
 	}
-	return
+
+	return w.align()
 }
 
 // Close closes the Huffman writer, properly sending EOF.
 // If the underlying io.Writer implements io.Closer,
 // it will be closed after sending EOF.
 func (w *Writer) Close() (err error) {
-	// If there were any data, write out eofValue
-	if len(w.leaves) > 2 {
-		// Write out eofValue's Huffman code
-		if err = w.bw.WriteBits(w.valueMap[eofValue].Code()); err != nil {
+	if w.header {
+		if err = w.writeHeader(); err != nil {
+			return
+		}
+	}
+
+	if w.enc != nil {
+		err = w.enc.close()
+	} else {
+		if len(w.block) > 0 {
+			if err = w.writeBlock(); err != nil {
+				return
+			}
+		}
+		for len(w.pending) > 0 {
+			if err = w.writePending(); err != nil {
+				return
+			}
+		}
+		if err = writeEndFrame(w.bw, w.o, w.frames, w.size); err != nil {
+			return
+		}
+		if w.index != nil {
+			err = w.index.write(w.bw)
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	return w.align()
+}
+
+// writeHeader writes the stream header.
+func (w *Writer) writeHeader() error {
+	w.header = false
+	n, err := writeHeader(w.bw, w.o)
+	if w.index != nil {
+		w.index.start = int64(n)
+	}
+	return err
+}
+
+// writeBlock encodes and writes the current block in block mode.
+// If Options.Concurrency is greater than 1, the block is encoded concurrently,
+// and only the oldest pending block is written (if the max number of pending blocks is reached).
+func (w *Writer) writeBlock() error {
+	if w.o.Concurrency <= 1 {
+		frame, err := encodeBlock(w.block, w.o)
+		if err != nil {
+			return err
+		}
+		size := len(w.block)
+		w.block = w.block[:0]
+		return w.writeFrame(frame, size)
+	}
+
+	data, ch := w.block, make(chan *blockResult, 1)
+	go func() {
+		frame, err := encodeBlock(data, w.o)
+		ch <- &blockResult{values: data, frame: frame, err: err}
+	}()
+	w.pending = append(w.pending, ch)
+
+	// Data is owned by the encoding goroutine, get a new buffer:
+	if len(w.free) > 0 {
+		w.block, w.free = w.free[len(w.free)-1], w.free[:len(w.free)-1]
+	} else {
+		w.block = make([]huffman.ValueType, 0, w.o.BlockSize)
+	}
+
+	if len(w.pending) == w.o.Concurrency {
+		return w.writePending()
+	}
+	return nil
+}
+
+// writePending waits for the oldest pending block to be encoded, and writes it.
+func (w *Writer) writePending() error {
+	res := <-w.pending[0]
+	w.pending = append(w.pending[:0], w.pending[1:]...)
+	w.free = append(w.free, res.values[:0])
+	if res.err != nil {
+		return res.err
+	}
+	return w.writeFrame(res.frame, len(res.values))
+}
+
+// writeFrame writes the frame of an encoded block, size is the size of the uncompressed block.
+func (w *Writer) writeFrame(frame []byte, size int) error {
+	if w.index != nil {
+		w.index.add(size, len(frame))
+	}
+	segmentSize, _ := binary.Uvarint(frame)
+	w.frames, w.size = w.frames+1, w.size+segmentSize
+	_, err := w.bw.Write(frame)
+	return err
+}
+
+// encoder encodes a segment: the Huffman codes of the data followed by eofValue
+// (and the trailer if Options.Checksum is set).
+// The whole stream is a single segment, or each block is a segment in block mode.
+type encoder struct {
+	bw *bitio.Writer
+	o  *Options
+
+	m        model               // Symbol model, nil in static mode
+	data     []huffman.ValueType // Buffered data in static mode (if Options.LiteralBits > 8)
+	byteData []byte              // Buffered data in static mode for the byte alphabet (1 byte per value instead of 4)
+	crc      uint32              // Checksum of the uncompressed data (if Options.Checksum)
+	n        uint64              // Length of the uncompressed data
+	last     huffman.ValueType   // Last written value, it is always known by the model
+	unsynced bool                // Tells if values were written since the last sync marker
+}
+
+// newEncoder creates a new encoder.
+func newEncoder(bw *bitio.Writer, o *Options) *encoder {
+	e := &encoder{bw: bw, o: o}
+	if o.Mode != ModeStatic {
+		e.m = newModel(o)
+	}
+	return e
+}
+
+// reset resets the encoder to start a new segment written to bw.
+func (e *encoder) reset(bw *bitio.Writer) {
+	if e.m != nil {
+		e.m.reset()
+	}
+	e.bw, e.data, e.byteData = bw, e.data[:0], e.byteData[:0]
+	e.crc, e.n, e.last, e.unsynced = 0, 0, 0, false
+}
+
+// writeValue encodes the value v.
+// ErrValueRange is returned if v is not in the alphabet (see Options.LiteralBits).
+func (e *encoder) writeValue(v huffman.ValueType) (err error) {
+	if !validValue(v, e.o) {
+		return ErrValueRange
+	}
+	if e.o.Checksum {
+		e.crc = updateCRCValue(e.crc, v, e.o)
+	}
+	e.n++
+
+	if e.m == nil {
+		if e.o.LiteralBits <= 8 {
+			e.byteData = append(e.byteData, byte(v))
+		} else {
+			e.data = append(e.data, v)
+		}
+		return nil
+	}
+	e.last, e.unsynced = v, true
+
+	if r, bits, ok := e.m.code(v); ok {
+		// Write out value's Huffman code
+		if err = e.bw.WriteBits(r, bits); err != nil {
+			return
+		}
+	} else {
+		// New value, write out newValue's Huffman code
+		r, bits, _ := e.m.code(newValue)
+		if err = e.bw.WriteBits(r, bits); err != nil {
+			return
+		}
+		// ...and the new value
+		if err = e.bw.WriteBits(uint64(v), uint8(e.o.LiteralBits)); err != nil {
+			return
+		}
+	}
+	e.m.add(v)
+	return
+}
+
+// flush writes a sync marker (if values were written since the last one): the code of newValue
+// followed by the last written value (which is known, so it is never written as a new value otherwise).
+// The underlying bitio.Writer is not aligned.
+// ErrFlush is returned in static mode.
+func (e *encoder) flush() (err error) {
+	if e.m == nil {
+		return ErrFlush
+	}
+	if !e.unsynced {
+		return nil
+	}
+	e.unsynced = false
+
+	r, bits, _ := e.m.code(newValue)
+	if err = e.bw.WriteBits(r, bits); err != nil {
+		return
+	}
+	return e.bw.WriteBits(uint64(e.last), uint8(e.o.LiteralBits))
+}
+
+// close ends the segment: writes eofValue and the trailer (if needed).
+// The underlying bitio.Writer is not closed.
+func (e *encoder) close() (err error) {
+	// If there were any data (or checksum is needed), write out eofValue's Huffman code
+	// (preceded by the code table and the encoded data in static mode)
+	if e.n > 0 || e.o.Checksum {
+		switch {
+		case e.m == nil && e.o.LiteralBits <= 8:
+			err = writeStatic(e.bw, e.byteData)
+		case e.m == nil:
+			err = writeStatic(e.bw, e.data)
+		default:
+			r, bits, _ := e.m.code(eofValue)
+			err = e.bw.WriteBits(r, bits)
+		}
+		if err != nil {
 			return
 		}
 	}
-	return w.bw.Close()
+
+	if e.o.Checksum {
+		return writeTrailer(e.bw, e.crc, e.n)
+	}
+	return nil
 }
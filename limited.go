@@ -0,0 +1,169 @@
+/*
+
+Length-limited Huffman code implementation (package-merge algorithm).
+
+*/
+
+package huffman
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrMaxBits is returned by BuildLimited if the leaves can't be coded with codes
+// not longer than the specified maximum length.
+var ErrMaxBits = errors.New("huffman: too many leaves for maxBits")
+
+// pmItem is an item of the package-merge algorithm: an original leaf or a package of 2 items.
+type pmItem struct {
+	count       int     // Count of the item
+	leaf        int     // Index of the leaf, -1 if this is a package
+	left, right *pmItem // Items of a package
+}
+
+// BuildLimited builds a Huffman tree from the specified leaves whose codes are not longer than maxBits.
+// The resulting codes are optimal under this constraint, computed by the package-merge algorithm.
+// Codes are assigned canonically (see AssignCanonical()).
+//
+// ErrMaxBits is returned if there are more than 1<<maxBits leaves.
+//
+// The passed slice is not modified (the Parent, Left and Right fields of the leaves are set).
+// Guaranteed that the same input slice will result in the same Huffman tree.
+func BuildLimited(leaves []*Node, maxBits byte) (*Node, error) {
+	n := len(leaves)
+	if n == 0 {
+		return nil, nil
+	}
+	if maxBits < 64 && n > 1<<maxBits {
+		return nil, ErrMaxBits
+	}
+	// Codes are never longer than n-1, so no need to iterate further:
+	if n-1 < int(maxBits) {
+		maxBits = byte(n - 1)
+	}
+
+	leaves = append([]*Node(nil), leaves...)
+	sort.Stable(SortNodes(leaves)) // Note: stable sort for deterministic output!
+
+	orig := make([]*pmItem, n)
+	for i, leaf := range leaves {
+		orig[i] = &pmItem{count: leaf.Count, leaf: i}
+	}
+
+	// Only the first 2n-2 items of the final list are used,
+	// so lists may always be truncated to that size.
+	maxItems := 2*n - 2
+	list := orig
+	for level := byte(1); level < maxBits; level++ {
+		// Package: pair adjacent items
+		packages := make([]*pmItem, 0, len(list)/2)
+		for i := 0; i+1 < len(list); i += 2 {
+			packages = append(packages, &pmItem{
+				count: list[i].count + list[i+1].count,
+				leaf:  -1,
+				left:  list[i],
+				right: list[i+1],
+			})
+		}
+
+		// Merge: packages with the original items, sorted by count
+		merged := make([]*pmItem, 0, n+len(packages))
+		for i, j := 0, 0; (i < n || j < len(packages)) && len(merged) < maxItems; {
+			if j == len(packages) || i < n && orig[i].count <= packages[j].count {
+				merged = append(merged, orig[i])
+				i++
+			} else {
+				merged = append(merged, packages[j])
+				j++
+			}
+		}
+		list = merged
+	}
+	if len(list) > maxItems {
+		list = list[:maxItems]
+	}
+
+	// Code length of a leaf is the number of times it occurs in the selected items:
+	lengths := make([]byte, n)
+	var count func(it *pmItem)
+	count = func(it *pmItem) {
+		if it.leaf >= 0 {
+			lengths[it.leaf]++
+			return
+		}
+		count(it.left)
+		count(it.right)
+	}
+	for _, it := range list {
+		count(it)
+	}
+
+	return buildCanonical(leaves, lengths), nil
+}
+
+// buildCanonical builds the Huffman tree of the canonical code where leaves[i] gets a code of length lengths[i].
+// Code lengths must describe a complete prefix code.
+// Counts of the internal nodes are set to the sum of the counts of their children.
+func buildCanonical(leaves []*Node, lengths []byte) *Node {
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	codes := make([]Code, len(leaves))
+	for i, leaf := range leaves {
+		// Value is used for ordering, but leaves may have the same value, so keep track of the index in Code:
+		codes[i] = Code{Value: leaf.Value, Code: uint64(i), Bits: lengths[i]}
+	}
+	sort.SliceStable(codes, func(i, j int) bool {
+		if codes[i].Bits != codes[j].Bits {
+			return codes[i].Bits < codes[j].Bits
+		}
+		return codes[i].Value < codes[j].Value
+	})
+
+	if codes[0].Bits == 0 {
+		// Single leaf, it is the root
+		root := leaves[codes[0].Code]
+		root.Parent, root.Left, root.Right = nil, nil, nil
+		return root
+	}
+
+	root := &Node{}
+	var code uint64
+	for i, c := range codes {
+		if i > 0 {
+			code = (code + 1) << (c.Bits - codes[i-1].Bits)
+		}
+		leaf := leaves[c.Code]
+		leaf.Left, leaf.Right = nil, nil
+
+		n := root
+		for bit := c.Bits - 1; ; bit-- {
+			child := &n.Left
+			if code&(1<<bit) != 0 {
+				child = &n.Right
+			}
+			if bit == 0 {
+				*child = leaf
+				leaf.Parent = n
+				break
+			}
+			if *child == nil {
+				*child = &Node{Parent: n}
+			}
+			n = *child
+		}
+	}
+
+	sumCounts(root)
+	return root
+}
+
+// sumCounts sets the counts of the internal nodes of a subtree to the sum of the counts of their children.
+func sumCounts(n *Node) int {
+	if n.Left != nil {
+		n.Count = sumCounts(n.Left) + sumCounts(n.Right)
+	}
+	return n.Count
+}
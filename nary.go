@@ -0,0 +1,96 @@
+/*
+
+N-ary Huffman code implementation.
+
+*/
+
+package huffman
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrArity is returned by BuildNary if the arity is not in the range [2, 256].
+var ErrArity = errors.New("huffman: arity must be between 2 and 256")
+
+// NaryNode is a node in an n-ary Huffman tree.
+type NaryNode struct {
+	Parent   *NaryNode   // Optional parent node, for fast code read-out
+	Children []*NaryNode // Children of the node (at most n), nil if this is a leaf
+	Count    int         // Relative frequency
+	Value    ValueType   // Optional value, set if this is a leaf
+}
+
+// Code returns the n-ary Huffman code of the node: the digits from the root to the node.
+// A digit is the index of the child in its parent's Children slice.
+// Implementation uses NaryNode.Parent to walk "up" in the tree.
+func (n *NaryNode) Code() (digits []byte) {
+	for parent := n.Parent; parent != nil; n, parent = parent, parent.Parent {
+		for i, child := range parent.Children {
+			if child == n {
+				digits = append(digits, byte(i))
+				break
+			}
+		}
+	}
+
+	// Digits were collected from the node up, reverse them:
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return
+}
+
+// BuildNary builds an n-ary Huffman tree from the specified leaves, where each internal node
+// has at most n children (so codes consist of digits in the range [0, n)).
+// n must be in the range [2, 256], else ErrArity is returned.
+// Guaranteed that the same input slice will result in the same Huffman tree.
+// The content of the passed slice is not modified.
+//
+// Children are ordered by count (ascending). If needed, dummy leaves with zero count are added
+// so that all internal nodes are full; the dummy leaves are removed after building the tree,
+// leaving the highest digits of one internal node (the deepest one) unused.
+// For n=2 the result is the same tree as built by Build.
+func BuildNary(leaves []*NaryNode, n int) (*NaryNode, error) {
+	if n < 2 || n > 256 {
+		return nil, ErrArity
+	}
+	if len(leaves) == 0 {
+		return nil, nil
+	}
+
+	var dummies int
+	if r := (len(leaves) - 1) % (n - 1); r != 0 {
+		dummies = n - 1 - r
+	}
+
+	h := make(nodeHeap[*NaryNode], 0, len(leaves)+dummies)
+	for i := 0; i < dummies; i++ {
+		// Dummies precede all nodes having zero count
+		h = append(h, heapItem[*NaryNode]{node: &NaryNode{}, prio: math.MinInt32 + i})
+	}
+	for i, leaf := range leaves {
+		h = append(h, heapItem[*NaryNode]{node: leaf, count: leaf.Count, prio: i})
+	}
+	h.init()
+
+	for prio := -1; len(h) > 1; prio-- {
+		parent := &NaryNode{Children: make([]*NaryNode, 0, n)}
+		for i := 0; i < n; i++ {
+			child := h.pop().node
+			if i < dummies {
+				continue // Dummies are the first nodes merged, leave them out
+			}
+			child.Parent = parent
+			parent.Children = append(parent.Children, child)
+			parent.Count += child.Count
+		}
+		dummies = 0
+		h.push(heapItem[*NaryNode]{node: parent, count: parent.Count, prio: prio})
+	}
+
+	root := h[0].node
+	root.Parent = nil
+	return root, nil
+}
@@ -0,0 +1,104 @@
+package huffman
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestBuildNary(t *testing.T) {
+	for _, n := range []int{-1, 0, 1, 257} {
+		if _, err := BuildNary(nil, n); err != ErrArity {
+			t.Errorf("[n=%d] Got: %v, want: %v", n, err, ErrArity)
+		}
+	}
+	if root, err := BuildNary(nil, 3); root != nil || err != nil {
+		t.Errorf("Got: %v, %v, want: nil, nil", root, err)
+	}
+
+	// 4 leaves, ternary: 1 dummy is needed
+	leaves := []*NaryNode{
+		{Value: 'a', Count: 5},
+		{Value: 'b', Count: 1},
+		{Value: 'c', Count: 2},
+		{Value: 'd', Count: 3},
+	}
+	root, err := BuildNary(leaves, 3)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	expected := map[ValueType][]byte{'b': {0, 0}, 'c': {0, 1}, 'd': {1}, 'a': {2}}
+	for _, leaf := range leaves {
+		if got := leaf.Code(); !bytes.Equal(got, expected[leaf.Value]) {
+			t.Errorf("Got: %v, want: %v (value: '%c')", got, expected[leaf.Value], leaf.Value)
+		}
+	}
+	if root.Count != 11 || len(root.Children) != 3 || len(root.Children[0].Children) != 2 {
+		t.Errorf("Unexpected tree: count: %d, children: %d", root.Count, len(root.Children))
+	}
+
+	// Single leaf
+	leaf := &NaryNode{Value: 'x', Count: 1}
+	if root, err := BuildNary([]*NaryNode{leaf}, 4); root != leaf || err != nil || len(leaf.Code()) != 0 {
+		t.Errorf("Got: %v, %v, want: %v", root, err, leaf)
+	}
+
+	for i := 0; i < 200; i++ {
+		count := rand.Intn(300) + 1
+		n := rand.Intn(255) + 2
+		if i%2 == 0 {
+			n = rand.Intn(6) + 2
+		}
+		leaves := make([]*NaryNode, count)
+		binLeaves := make([]*Node, count)
+		for j := range leaves {
+			c := rand.Intn(100)
+			leaves[j] = &NaryNode{Value: ValueType(j), Count: c}
+			binLeaves[j] = &Node{Value: ValueType(j), Count: c}
+		}
+		if _, err := BuildNary(leaves, n); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+
+		// Codes must be prefix-free and complete except for the unused digits of the deepest node:
+		// Kraft sum must be 1 - (unused digits) * n^-maxLen
+		kraft, maxLen := 0.0, 0
+		seen := map[string]bool{}
+		for _, leaf := range leaves {
+			code := leaf.Code()
+			for _, d := range code {
+				if int(d) >= n {
+					t.Fatalf("[n=%d] Digit out of range: %v", n, code)
+				}
+			}
+			for k := 0; k <= len(code); k++ {
+				if seen[string(code[:k])] {
+					t.Fatalf("[n=%d] Not prefix-free: %v", n, code)
+				}
+			}
+			seen[string(code)] = true
+			if len(code) > maxLen {
+				maxLen = len(code)
+			}
+		}
+		for _, leaf := range leaves {
+			kraft += math.Pow(float64(n), -float64(len(leaf.Code())))
+		}
+		if count > 1 && (kraft > 1+1e-9 || kraft < 1-float64(n-2)*math.Pow(float64(n), -float64(maxLen))-1e-9) {
+			t.Errorf("[n=%d] Unexpected Kraft sum: %v", n, kraft)
+		}
+
+		// Binary n-ary tree must be the same as the binary tree
+		if n == 2 {
+			Build(binLeaves)
+			for j, leaf := range leaves {
+				r, bits := binLeaves[j].Code()
+				code := leaf.Code()
+				if formatCode(r, bits) != string(bytes.Map(func(r rune) rune { return r + '0' }, code)) {
+					t.Fatalf("Got: %v, want: %s", code, formatCode(r, bits))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+/*
+
+Printing Huffman trees in multiple formats.
+
+*/
+
+package huffman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format is the output format of Fprint.
+type Format int
+
+const (
+	// FormatText lists the values of the leaves with their code in binary representation, one per line,
+	// e.g. 'a': 0110
+	// Values which are valid runes are printed quoted (and escaped), others are printed as numbers.
+	FormatText Format = iota
+
+	// FormatDOT describes the tree in the Graphviz DOT language, for visualization.
+	FormatDOT
+
+	// FormatJSON is the JSON representation of the tree (see Node.MarshalJSON), indented.
+	FormatJSON
+)
+
+// ErrFormat is returned by Fprint if the format is unknown.
+var ErrFormat = errors.New("huffman: unknown format")
+
+// Fprint prints the Huffman tree to w in the specified format.
+// The output is written to w in one piece, only if it could be generated.
+func Fprint(w io.Writer, root *Node, format Format) error {
+	buf := &bytes.Buffer{}
+	switch format {
+	case FormatText:
+		printText(buf, root)
+	case FormatDOT:
+		printDOT(buf, root)
+	case FormatJSON:
+		data, err := json.MarshalIndent(root, "", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	default:
+		return ErrFormat
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatValue returns the printable form of a value:
+// quoted (and escaped) if it is a valid rune, the number otherwise.
+func formatValue(v ValueType) string {
+	if !utf8.ValidRune(rune(v)) {
+		return strconv.Itoa(int(v))
+	}
+	return strconv.QuoteRune(rune(v))
+}
+
+// printText prints the tree in FormatText.
+func printText(buf *bytes.Buffer, root *Node) {
+	if root == nil {
+		return
+	}
+
+	// traverse traverses a subtree from the given node,
+	// using the prefix code leading to this node, having the number of bits specified.
+	var traverse func(n *Node, code uint64, bits byte)
+
+	traverse = func(n *Node, code uint64, bits byte) {
+		if n.Left == nil {
+			// Leaf
+			fmt.Fprintf(buf, "%s: %0"+strconv.Itoa(int(bits))+"b\n", formatValue(n.Value), code)
+			return
+		}
+		bits++
+		traverse(n.Left, code<<1, bits)
+		traverse(n.Right, code<<1+1, bits)
+	}
+
+	traverse(root, 0, 0)
+}
+
+// dotEscaper escapes text for quoted strings of the DOT language.
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// printDOT prints the tree in FormatDOT.
+// Internal nodes are labeled with their count, leaves with their value and count,
+// edges with their bit.
+func printDOT(buf *bytes.Buffer, root *Node) {
+	buf.WriteString("digraph huffman {\n")
+	buf.WriteString("\tnode [shape=circle];\n")
+
+	id := 0
+	var traverse func(n *Node) int
+	traverse = func(n *Node) int {
+		nid := id
+		id++
+		if n.Left == nil {
+			fmt.Fprintf(buf, "\tn%d [shape=box, label=\"%s\\n%d\"];\n", nid, dotEscaper.Replace(formatValue(n.Value)), n.Count)
+			return nid
+		}
+		fmt.Fprintf(buf, "\tn%d [label=\"%d\"];\n", nid, n.Count)
+		fmt.Fprintf(buf, "\tn%d -> n%d [label=\"0\"];\n", nid, traverse(n.Left))
+		fmt.Fprintf(buf, "\tn%d -> n%d [label=\"1\"];\n", nid, traverse(n.Right))
+		return nid
+	}
+	if root != nil {
+		traverse(root)
+	}
+
+	buf.WriteString("}\n")
+}
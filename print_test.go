@@ -0,0 +1,87 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFprint(t *testing.T) {
+	leaves := []*Node{
+		{Value: ' ', Count: 20},
+		{Value: 'a', Count: 40},
+		{Value: 'm', Count: 10},
+		{Value: '\n', Count: 7},
+		{Value: -1, Count: 8},
+		{Value: '"', Count: 15},
+	}
+	root := Build(leaves)
+
+	cases := []struct {
+		name   string
+		root   *Node
+		format Format
+		exp    string
+	}{
+		{"text", root, FormatText, `'a': 0
+'m': 100
+'\n': 1010
+-1: 1011
+'"': 110
+' ': 111
+`},
+		{"text-nil", nil, FormatText, ""},
+		{"dot", Build([]*Node{{Value: '"', Count: 1}, {Value: 'b', Count: 2}}), FormatDOT, `digraph huffman {
+	node [shape=circle];
+	n0 [label="3"];
+	n1 [shape=box, label="'\"'\n1"];
+	n0 -> n1 [label="0"];
+	n2 [shape=box, label="'b'\n2"];
+	n0 -> n2 [label="1"];
+}
+`},
+		{"dot-nil", nil, FormatDOT, "digraph huffman {\n\tnode [shape=circle];\n}\n"},
+		{"json-nil", nil, FormatJSON, "null\n"},
+	}
+	for _, c := range cases {
+		buf := &bytes.Buffer{}
+		if err := Fprint(buf, c.root, c.format); err != nil {
+			t.Errorf("[%s] Got error: %v", c.name, err)
+		}
+		if got := buf.String(); got != c.exp {
+			t.Errorf("[%s] Got:\n%s\nwant:\n%s", c.name, got, c.exp)
+		}
+	}
+
+	// JSON must be the indented form of the tree
+	buf := &bytes.Buffer{}
+	if err := Fprint(buf, root, FormatJSON); err != nil {
+		t.Errorf("Got error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "\n  \"count\": 100,\n") {
+		t.Errorf("Not indented: %s", buf.String())
+	}
+	root2 := &Node{}
+	if err := json.Unmarshal(buf.Bytes(), root2); err != nil || treeString(root2) != treeString(root) {
+		t.Errorf("Got: %v, %v, want: %s", err, treeString(root2), treeString(root))
+	}
+
+	if err := Fprint(buf, root, Format(-1)); err != ErrFormat {
+		t.Errorf("Got: %v, want: %v", err, ErrFormat)
+	}
+	errTest := errors.New("test error")
+	if err := Fprint(&errWriter{errTest}, root, FormatText); err != errTest {
+		t.Errorf("Got: %v, want: %v", err, errTest)
+	}
+}
+
+// errWriter is an io.Writer which always returns an error.
+type errWriter struct {
+	err error
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,258 @@
+/*
+
+Serialization of Huffman trees and code tables.
+
+*/
+
+package huffman
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// binaryVersion is the version of the binary serialization format.
+const binaryVersion = 1
+
+var (
+	// ErrInvalidBinary is returned if unmarshaling invalid binary data is attempted.
+	ErrInvalidBinary = errors.New("huffman: invalid binary data")
+
+	// ErrInvalidJSON is returned if unmarshaling JSON data not describing a valid tree or table is attempted.
+	ErrInvalidJSON = errors.New("huffman: invalid JSON data")
+
+	// ErrEmptyTree is returned if marshaling an empty (nil) tree is attempted, which can't be unmarshaled into a Node.
+	ErrEmptyTree = errors.New("huffman: empty tree")
+)
+
+// marshalLengths returns the binary form of the code lengths of the codes.
+//
+// The binary form is the format version, followed by the number of codes, followed by the codes
+// (sorted by value) as the difference of its value to the previous value and the code length.
+// Numbers (except the code length) are varint encoded.
+func marshalLengths(codes []Code) []byte {
+	sorted := append([]Code(nil), codes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Value < sorted[j].Value })
+
+	data := make([]byte, 1+binary.MaxVarintLen64, 1+binary.MaxVarintLen64+len(sorted)*3)
+	data[0] = binaryVersion
+	data = data[:1+binary.PutUvarint(data[1:], uint64(len(sorted)))]
+
+	var buf [binary.MaxVarintLen64]byte
+	var prev ValueType
+	for _, c := range sorted {
+		data = append(data, buf[:binary.PutVarint(buf[:], int64(c.Value)-int64(prev))]...)
+		data = append(data, c.Bits)
+		prev = c.Value
+	}
+	return data
+}
+
+// unmarshalLengths parses the binary form of code lengths created by marshalLengths(),
+// and returns the canonical codes (see AssignCanonical()).
+// Code lengths are validated, they must describe a complete prefix code (or no codes at all).
+func unmarshalLengths(data []byte) ([]Code, error) {
+	if len(data) == 0 || data[0] != binaryVersion {
+		return nil, ErrInvalidBinary
+	}
+	data = data[1:]
+
+	count, n := binary.Uvarint(data)
+	// Each code takes at least 2 bytes:
+	if n <= 0 || count > uint64(len(data)-n)/2 {
+		return nil, ErrInvalidBinary
+	}
+	data = data[n:]
+
+	codes := make([]Code, count)
+	var value int64
+	for i := range codes {
+		diff, n := binary.Varint(data)
+		if n <= 0 || n >= len(data) {
+			return nil, ErrInvalidBinary
+		}
+		if value += diff; value != int64(ValueType(value)) || i > 0 && diff <= 0 {
+			return nil, ErrInvalidBinary
+		}
+		codes[i] = Code{Value: ValueType(value), Bits: data[n]}
+		data = data[n+1:]
+	}
+	if len(data) > 0 {
+		return nil, ErrInvalidBinary
+	}
+	if len(codes) == 0 {
+		return codes, nil // Empty table
+	}
+
+	for _, c := range codes {
+		if c.Bits > 64 {
+			return nil, ErrInvalidBinary
+		}
+	}
+	if checkLengths(codes) != nil {
+		return nil, ErrInvalidBinary
+	}
+	AssignCanonical(codes)
+	return codes, nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// Only the code lengths are serialized, so after unmarshaling the codes of the table will be
+// the canonical codes (see AssignCanonical()). Use canonical codes (e.g. create the table using
+// NewTableCodes(CanonicalTree(root))) if the unmarshaled table must give the same codes.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	return marshalLengths(t.Codes()), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	codes, err := unmarshalLengths(data)
+	if err != nil {
+		return err
+	}
+	t2, err := NewTableCodes(codes)
+	if err != nil {
+		return err
+	}
+	*t = *t2
+	return nil
+}
+
+// jsonCode is the JSON representation of a code in a table.
+type jsonCode struct {
+	Value ValueType `json:"value"`
+	Code  string    `json:"code"` // Bits of the code, e.g. "0110"
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// The JSON representation of a table is an array of objects holding the values and their codes,
+// for example:
+//
+//	[{"value":97,"code":"0"},{"value":98,"code":"10"},{"value":99,"code":"11"}]
+func (t *Table) MarshalJSON() ([]byte, error) {
+	codes := t.Codes()
+	jcodes := make([]jsonCode, len(codes))
+	for i, c := range codes {
+		b := make([]byte, c.Bits)
+		for j := range b {
+			b[j] = '0' + byte(c.Code>>(int(c.Bits)-1-j)&1)
+		}
+		jcodes[i] = jsonCode{Value: c.Value, Code: string(b)}
+	}
+	return json.Marshal(jcodes)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Table) UnmarshalJSON(data []byte) error {
+	var jcodes []jsonCode
+	if err := json.Unmarshal(data, &jcodes); err != nil {
+		return err
+	}
+
+	codes := make([]Code, len(jcodes))
+	for i, jc := range jcodes {
+		if len(jc.Code) > 64 || strings.Trim(jc.Code, "01") != "" {
+			return ErrInvalidJSON
+		}
+		codes[i] = Code{Value: jc.Value, Bits: byte(len(jc.Code))}
+		for _, ch := range jc.Code {
+			codes[i].Code = codes[i].Code<<1 | uint64(ch-'0')
+		}
+	}
+
+	t2, err := NewTableCodes(codes)
+	if err != nil {
+		return err
+	}
+	*t = *t2
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+// n is treated as the root of a Huffman tree.
+//
+// Only the code lengths are serialized, so the unmarshaled tree will be the tree of the
+// canonical codes (see AssignCanonical()), and counts are not retained.
+// Use JSON serialization to retain the exact tree.
+//
+// ErrEmptyTree is returned if n is nil.
+func (n *Node) MarshalBinary() ([]byte, error) {
+	if n == nil {
+		return nil, ErrEmptyTree
+	}
+	return marshalLengths(CanonicalTree(n)), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// n becomes the root of the unmarshaled Huffman tree.
+func (n *Node) UnmarshalBinary(data []byte) error {
+	codes, err := unmarshalLengths(data)
+	if err != nil {
+		return err
+	}
+	root, err := FromLengths(codes)
+	if err != nil {
+		return ErrInvalidBinary
+	}
+	n.setRoot(root)
+	return nil
+}
+
+// setRoot makes n a copy of the root node (and the parent of its children).
+func (n *Node) setRoot(root *Node) {
+	*n = *root
+	n.Parent = nil
+	if n.Left != nil {
+		n.Left.Parent = n
+		n.Right.Parent = n
+	}
+}
+
+// jsonNode is the JSON representation of a node.
+type jsonNode struct {
+	Value *ValueType `json:"value,omitempty"` // Only set for leaves
+	Count int        `json:"count"`
+	Left  *Node      `json:"left,omitempty"`
+	Right *Node      `json:"right,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+// n is treated as the root of a Huffman tree.
+//
+// The JSON representation of a tree is the exact structure of the tree, including counts,
+// for example:
+//
+//	{"count":3,"left":{"value":97,"count":1},"right":{"value":98,"count":2}}
+func (n *Node) MarshalJSON() ([]byte, error) {
+	jn := jsonNode{Count: n.Count, Left: n.Left, Right: n.Right}
+	if n.Left == nil {
+		value := n.Value
+		jn.Value = &value
+	}
+	return json.Marshal(jn)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// n becomes the root of the unmarshaled Huffman tree.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var jn jsonNode
+	if err := json.Unmarshal(data, &jn); err != nil {
+		return err
+	}
+
+	node := &Node{Count: jn.Count, Left: jn.Left, Right: jn.Right}
+	switch {
+	case jn.Value != nil && jn.Left == nil && jn.Right == nil:
+		node.Value = *jn.Value
+	case jn.Value == nil && jn.Left != nil && jn.Right != nil:
+	default:
+		return ErrInvalidJSON // Leaves must have a value, internal nodes must have 2 children
+	}
+	n.setRoot(node)
+	return nil
+}
@@ -0,0 +1,171 @@
+package huffman
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTableMarshalBinary(t *testing.T) {
+	leaves := []*Node{
+		{Value: ' ', Count: 20},
+		{Value: 'a', Count: 40},
+		{Value: 'l', Count: 7},
+		{Value: 'm', Count: 10},
+		{Value: 'f', Count: 8},
+		{Value: 't', Count: 15},
+		{Value: -1, Count: 1},
+		{Value: 1<<31 - 1, Count: 1},
+	}
+	codes := CanonicalTree(Build(leaves))
+	table, err := NewTableCodes(codes)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	data, err := table.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	table2 := &Table{}
+	if err := table2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	codes2 := table2.Codes()
+	if len(codes2) != len(codes) {
+		t.Fatalf("Got: %v, want: %v", codes2, codes)
+	}
+	for i, c := range codes {
+		if codes2[i] != c {
+			t.Errorf("Got: %v, want: %v", codes2[i], c)
+		}
+	}
+
+	// Corrupted data must be detected
+	invalids := [][]byte{
+		nil,
+		{},
+		{2},
+		data[:len(data)-1],
+		append(data[:len(data):len(data)], 0),
+		{binaryVersion, 2, 2, 1, 2, 2},       // Incomplete code
+		{binaryVersion, 3, 2, 1, 2, 1, 2, 1}, // Over-subscribed code
+		{binaryVersion, 2, 2, 1, 0, 1},       // Duplicate value
+	}
+	for i, v := range invalids {
+		if err := table2.UnmarshalBinary(v); err != ErrInvalidBinary {
+			t.Errorf("[%d] Got: %v, want: %v", i, err, ErrInvalidBinary)
+		}
+	}
+
+	// Empty table
+	table, _ = NewTableCodes(nil)
+	if data, err = table.MarshalBinary(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if err := table2.UnmarshalBinary(data); err != nil || len(table2.Codes()) != 0 {
+		t.Errorf("Got: %v, %v, want: empty table", table2.Codes(), err)
+	}
+}
+
+func TestTableMarshalJSON(t *testing.T) {
+	// Codes don't have to be canonical
+	table, _ := NewTableCodes([]Code{{'a', 1, 1}, {'b', 1, 2}, {'c', 0, 2}})
+
+	data, err := json.Marshal(table)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if exp := `[{"value":97,"code":"1"},{"value":98,"code":"01"},{"value":99,"code":"00"}]`; string(data) != exp {
+		t.Errorf("Got: %s, want: %s", data, exp)
+	}
+
+	table2 := &Table{}
+	if err := json.Unmarshal(data, table2); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	for _, v := range []ValueType{'a', 'b', 'c'} {
+		r, bits, _ := table.Encode(v)
+		if r2, bits2, ok := table2.Encode(v); r2 != r || bits2 != bits || !ok {
+			t.Errorf("Got: %b, %d, %v, want: %b, %d, true", r2, bits2, ok, r, bits)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`[{"value":97,"code":"012"}]`), table2); err != ErrInvalidJSON {
+		t.Errorf("Got: %v, want: %v", err, ErrInvalidJSON)
+	}
+	if err := json.Unmarshal([]byte(`[{"value":97,"code":"0"},{"value":98,"code":"01"}]`), table2); err != ErrNotPrefixFree {
+		t.Errorf("Got: %v, want: %v", err, ErrNotPrefixFree)
+	}
+}
+
+func TestNodeMarshal(t *testing.T) {
+	leaves := []*Node{
+		{Value: ' ', Count: 20},
+		{Value: 'a', Count: 40},
+		{Value: 'l', Count: 7},
+		{Value: 'm', Count: 10},
+		{Value: 'f', Count: 8},
+		{Value: 't', Count: 15},
+	}
+	root := Build(leaves)
+	codes := CanonicalTree(root)
+
+	data, err := root.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	root2 := &Node{}
+	if err := root2.UnmarshalBinary(data); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	if _, err := (*Node)(nil).MarshalBinary(); err != ErrEmptyTree {
+		t.Errorf("Got: %v, want: %v", err, ErrEmptyTree)
+	}
+	if err := (&Node{}).UnmarshalBinary([]byte{binaryVersion, 0}); err != ErrInvalidBinary {
+		t.Errorf("Got: %v, want: %v", err, ErrInvalidBinary)
+	}
+	// Leaves of the canonical tree must have the canonical codes:
+	for _, leaf := range Leaves(root2) {
+		r, bits := leaf.Code()
+		found := false
+		for _, c := range codes {
+			if c.Value == leaf.Value {
+				found = true
+				if c.Code != r || c.Bits != bits {
+					t.Errorf("Got: %b, %d, want: %b, %d", r, bits, c.Code, c.Bits)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("Unexpected leaf: %v", leaf.Value)
+		}
+	}
+
+	// JSON retains the exact tree
+	data, err = json.Marshal(root)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	root3 := &Node{}
+	if err := json.Unmarshal(data, root3); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+	leaves, leaves3 := Leaves(root), Leaves(root3)
+	if len(leaves) != len(leaves3) || root3.Count != root.Count {
+		t.Fatalf("Got: %d leaves, count: %d, want: %d, %d", len(leaves3), root3.Count, len(leaves), root.Count)
+	}
+	for i, leaf := range leaves {
+		r, bits := leaf.Code()
+		r3, bits3 := leaves3[i].Code()
+		if leaves3[i].Value != leaf.Value || leaves3[i].Count != leaf.Count || r3 != r || bits3 != bits {
+			t.Errorf("Got: %v, want: %v", leaves3[i], leaf)
+		}
+	}
+
+	for _, s := range []string{`{"count":1}`, `{"value":1,"left":{"value":2}}`, `{"left":{"value":2}}`} {
+		if err := json.Unmarshal([]byte(s), root3); err != ErrInvalidJSON {
+			t.Errorf("[%s] Got: %v, want: %v", s, err, ErrInvalidJSON)
+		}
+	}
+}
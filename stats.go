@@ -0,0 +1,91 @@
+/*
+
+Code quality statistics of Huffman trees.
+
+*/
+
+package huffman
+
+import "math"
+
+// TreeStats holds statistics of a Huffman tree, describing the quality of the code
+// for the distribution given by the counts of its leaves.
+type TreeStats struct {
+	Leaves     int     // Number of leaves (values)
+	Total      int     // Sum of the counts of the leaves
+	Entropy    float64 // Shannon entropy of the distribution, in bits per value
+	AvgLen     float64 // Average code length weighted by the counts, in bits per value
+	Redundancy float64 // Redundancy of the code: AvgLen - Entropy
+	MinDepth   int     // Min code length (depth of leaves)
+	MaxDepth   int     // Max code length (depth of leaves)
+	KraftSum   float64 // Sum of 2^-length over all codes, 1 for complete prefix codes
+	Bits       uint64  // Size of the encoded data (all leaves with their counts), in bits
+}
+
+// Stats returns the statistics of the Huffman tree.
+// Leaves with zero count don't contribute to Entropy and AvgLen.
+// The zero value is returned for a nil tree.
+func Stats(root *Node) (s TreeStats) {
+	if root == nil {
+		return
+	}
+
+	s.MinDepth = math.MaxInt32
+	var counts []int
+	var traverse func(n *Node, depth int)
+	traverse = func(n *Node, depth int) {
+		if n.Left != nil {
+			traverse(n.Left, depth+1)
+			traverse(n.Right, depth+1)
+			return
+		}
+		counts = append(counts, n.Count)
+		s.Leaves++
+		s.Total += n.Count
+		s.Bits += uint64(n.Count) * uint64(depth)
+		s.KraftSum += math.Ldexp(1, -depth)
+		if depth < s.MinDepth {
+			s.MinDepth = depth
+		}
+		if depth > s.MaxDepth {
+			s.MaxDepth = depth
+		}
+	}
+	traverse(root, 0)
+
+	if s.Total > 0 {
+		total := float64(s.Total)
+		for _, count := range counts {
+			if count > 0 {
+				p := float64(count) / total
+				s.Entropy -= p * math.Log2(p)
+			}
+		}
+		s.AvgLen = float64(s.Bits) / total
+		s.Redundancy = s.AvgLen - s.Entropy
+	}
+	return
+}
+
+// EncodedBits returns the size of data having the specified value counts
+// encoded with the Huffman tree, in bits.
+// ok is false if a value with positive count is not in the tree.
+func EncodedBits(root *Node, counts map[ValueType]int) (bits uint64, ok bool) {
+	codeLens := make(map[ValueType]byte)
+	for _, leaf := range Leaves(root) {
+		_, bits := leaf.Code()
+		codeLens[leaf.Value] = bits
+	}
+
+	for v, count := range counts {
+		if count <= 0 {
+			continue
+		}
+		codeLen, found := codeLens[v]
+		if !found {
+			return 0, false
+		}
+		bits += uint64(count) * uint64(codeLen)
+	}
+	return bits, true
+}
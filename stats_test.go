@@ -0,0 +1,74 @@
+package huffman
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	if s := Stats(nil); s != (TreeStats{}) {
+		t.Errorf("Got: %+v, want: zero value", s)
+	}
+
+	root := Build([]*Node{
+		{Value: ' ', Count: 20},
+		{Value: 'a', Count: 40},
+		{Value: 'm', Count: 10},
+		{Value: 'l', Count: 7},
+		{Value: 'f', Count: 8},
+		{Value: 't', Count: 15},
+	})
+
+	var entropy float64
+	for _, count := range []float64{20, 40, 10, 7, 8, 15} {
+		entropy -= count / 100 * math.Log2(count/100)
+	}
+	// Code lengths: 'a': 1, 'm', 't', ' ': 3, 'l', 'f': 4
+	bits := uint64(40*1 + (10+15+20)*3 + (7+8)*4)
+
+	s := Stats(root)
+	exp := TreeStats{
+		Leaves:     6,
+		Total:      100,
+		Entropy:    entropy,
+		AvgLen:     float64(bits) / 100,
+		Redundancy: float64(bits)/100 - entropy,
+		MinDepth:   1,
+		MaxDepth:   4,
+		KraftSum:   1,
+		Bits:       bits,
+	}
+	// Float sums depend on the order of the leaves
+	if math.Abs(s.Entropy-exp.Entropy) < 1e-12 && math.Abs(s.Redundancy-exp.Redundancy) < 1e-12 {
+		s.Entropy, s.Redundancy = exp.Entropy, exp.Redundancy
+	}
+	if s != exp {
+		t.Errorf("Got: %+v, want: %+v", s, exp)
+	}
+	if s.Redundancy < 0 || s.Redundancy >= 1 {
+		t.Errorf("Redundancy out of [0, 1): %v", s.Redundancy)
+	}
+
+	// Single leaf
+	s = Stats(Build([]*Node{{Value: 'a', Count: 5}}))
+	exp = TreeStats{Leaves: 1, Total: 5, KraftSum: 1}
+	if s != exp {
+		t.Errorf("Got: %+v, want: %+v", s, exp)
+	}
+
+	// Encoded size of other counts
+	cases := []struct {
+		counts map[ValueType]int
+		bits   uint64
+		ok     bool
+	}{
+		{nil, 0, true},
+		{map[ValueType]int{'a': 3, 'l': 2, 'x': 0}, 3*1 + 2*4, true},
+		{map[ValueType]int{'a': 3, 'x': 1}, 0, false},
+	}
+	for i, c := range cases {
+		if bits, ok := EncodedBits(root, c.counts); bits != c.bits || ok != c.ok {
+			t.Errorf("[%d] Got: %d, %v, want: %d, %v", i, bits, ok, c.bits, c.ok)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+/*
+
+Huffman code table implementation: fast encoding and lookup table based decoding.
+
+*/
+
+package huffman
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// lookupBits is the max number of bits used to index a lookup table.
+// Longer codes are resolved using sub-tables.
+const lookupBits = 9
+
+var (
+	// ErrInvalidCode is returned by Table.Decode() if the input contains a code not present in the table.
+	ErrInvalidCode = errors.New("huffman: invalid code")
+
+	// ErrNotPrefixFree is returned if a code table is not prefix-free (a code is a prefix of another one).
+	ErrNotPrefixFree = errors.New("huffman: codes are not prefix-free")
+
+	// ErrDuplicateValue is returned if a code table contains a value more than once.
+	ErrDuplicateValue = errors.New("huffman: duplicate value")
+
+	// ErrCodeTooLong is returned if a code is longer than 64 bits.
+	ErrCodeTooLong = errors.New("huffman: code longer than 64 bits")
+)
+
+// entry is an entry of a lookup table.
+type entry struct {
+	value ValueType // Decoded value
+	bits  uint8     // Number of bits of the code in the lookup table this entry is part of
+	next  int32     // Index of the sub-table if positive, 0 if this entry holds a value, -1 if unused
+}
+
+// lookup is a lookup table, indexed by the next bits bits of the input.
+type lookup struct {
+	bits    uint8
+	entries []entry
+}
+
+// Table is a Huffman code table which provides fast encoding and decoding.
+// Encoding is a simple map lookup, decoding uses multi-level lookup tables.
+//
+// Table must not be modified after creation, but it is safe for concurrent use.
+type Table struct {
+	codes  map[ValueType]Code // Codes by value
+	tables []lookup           // Lookup tables, the first is the root
+}
+
+// NewTable creates a new Table from the Huffman tree.
+// ErrCodeTooLong is returned if the depth of the tree exceeds 64,
+// ErrDuplicateValue if multiple leaves have the same value.
+func NewTable(root *Node) (*Table, error) {
+	var codes []Code
+
+	var traverse func(n *Node, code uint64, bits byte)
+	traverse = func(n *Node, code uint64, bits byte) {
+		if n.Left == nil {
+			codes = append(codes, Code{Value: n.Value, Code: code, Bits: bits})
+			return
+		}
+		bits++
+		traverse(n.Left, code<<1, bits)
+		traverse(n.Right, code<<1+1, bits)
+	}
+	if root != nil {
+		traverse(root, 0, 0)
+	}
+
+	return NewTableCodes(codes)
+}
+
+// NewTableCodes creates a new Table from the specified codes.
+// Codes are not required to be canonical, but they must be prefix-free.
+// The passed slice is not modified.
+func NewTableCodes(codes []Code) (*Table, error) {
+	t := &Table{codes: make(map[ValueType]Code, len(codes))}
+	for _, c := range codes {
+		if c.Bits > 64 {
+			return nil, ErrCodeTooLong
+		}
+		if _, ok := t.codes[c.Value]; ok {
+			return nil, ErrDuplicateValue
+		}
+		t.codes[c.Value] = c
+	}
+
+	if len(codes) > 0 {
+		sorted := t.Codes()
+		if _, err := t.build(sorted, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// build builds a lookup table for the codes which all share the same prefix of consumed bits,
+// and returns its index.
+// Codes must be sorted by length.
+func (t *Table) build(codes []Code, consumed uint8) (idx int32, err error) {
+	bits := codes[len(codes)-1].Bits - consumed
+	if bits > lookupBits {
+		bits = lookupBits
+	}
+
+	idx = int32(len(t.tables))
+	entries := make([]entry, 1<<bits)
+	for i := range entries {
+		entries[i].next = -1
+	}
+	t.tables = append(t.tables, lookup{bits: bits, entries: entries})
+
+	// Codes that fit into this table fill a range of entries,
+	// longer codes are grouped by their first bits and go to sub-tables.
+	var prefixes []uint64
+	groups := map[uint64][]Code{}
+	for _, c := range codes {
+		rem := c.Bits - consumed
+		code := c.Code & (1<<rem - 1)
+		if rem > bits {
+			prefix := code >> (rem - bits)
+			if _, ok := groups[prefix]; !ok {
+				prefixes = append(prefixes, prefix)
+			}
+			groups[prefix] = append(groups[prefix], c)
+			continue
+		}
+		start := code << (bits - rem)
+		for i := start; i < start+1<<(bits-rem); i++ {
+			if entries[i].next != -1 {
+				return 0, ErrNotPrefixFree
+			}
+			entries[i] = entry{value: c.Value, bits: rem}
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if entries[prefix].next != -1 {
+			return 0, ErrNotPrefixFree
+		}
+		var sub int32
+		if sub, err = t.build(groups[prefix], consumed+bits); err != nil {
+			return
+		}
+		entries[prefix] = entry{bits: bits, next: sub}
+	}
+
+	return
+}
+
+// Encode returns the Huffman code of the specified value.
+// ok is false if the value is not in the table.
+func (t *Table) Encode(value ValueType) (r uint64, bits byte, ok bool) {
+	c, ok := t.codes[value]
+	return c.Code, c.Bits, ok
+}
+
+// Decode reads the next Huffman code from the source, and returns its value.
+//
+// io.EOF is returned if the source has no more bits when a code begins,
+// io.ErrUnexpectedEOF if it ends in the middle of a code.
+// ErrInvalidCode is returned if the input contains a code not present in the table
+// (only possible if the codes of the table are incomplete).
+//
+// The code of a single leaf tree has 0 bits, decoding it does not consume input,
+// but io.EOF is still returned if the source has no more bits.
+func (t *Table) Decode(src BitPeeker) (value ValueType, err error) {
+	if len(t.tables) == 0 {
+		return 0, ErrInvalidCode
+	}
+
+	// eof returns the error to report if the source ran out of bits.
+	eof := func(lk *lookup, avail uint8, err error) error {
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if avail == 0 && lk == &t.tables[0] {
+			return io.EOF
+		}
+		return io.ErrUnexpectedEOF
+	}
+
+	lk := &t.tables[0]
+	for {
+		u, avail, err := src.PeekBits(lk.bits)
+		e := lk.entries[u]
+		switch {
+		case e.next < 0:
+			if avail < lk.bits {
+				return 0, eof(lk, avail, err)
+			}
+			return 0, ErrInvalidCode
+		case e.next > 0:
+			if avail < lk.bits {
+				return 0, eof(lk, avail, err)
+			}
+			src.SkipBits(lk.bits)
+			lk = &t.tables[e.next]
+		default:
+			if e.bits == 0 {
+				// Only a single 0-bit code, check if there is input left:
+				_, avail, err = src.PeekBits(1)
+			}
+			if avail < e.bits || avail == 0 {
+				return 0, eof(lk, avail, err)
+			}
+			src.SkipBits(e.bits)
+			return e.value, nil
+		}
+	}
+}
+
+// Codes returns the codes of the table, sorted by code length first, then by value.
+func (t *Table) Codes() []Code {
+	codes := make([]Code, 0, len(t.codes))
+	for _, c := range t.codes {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].Bits != codes[j].Bits {
+			return codes[i].Bits < codes[j].Bits
+		}
+		return codes[i].Value < codes[j].Value
+	})
+	return codes
+}
@@ -0,0 +1,152 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+func TestTable(t *testing.T) {
+	// Fibonacci counts result in a deep tree which needs multiple levels of lookup tables
+	var leaves []*Node
+	for i, a, b := 0, 1, 1; i < 40; i, a, b = i+1, b, a+b {
+		leaves = append(leaves, &Node{Value: ValueType(i), Count: a})
+	}
+	root := Build(append([]*Node(nil), leaves...))
+
+	table, err := NewTable(root)
+	if err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	for _, leaf := range leaves {
+		r, bits := leaf.Code()
+		r2, bits2, ok := table.Encode(leaf.Value)
+		if !ok || r != r2 || bits != bits2 {
+			t.Errorf("Got: %b, %d, %v, want: %b, %d, true", r2, bits2, ok, r, bits)
+		}
+	}
+	if _, _, ok := table.Encode(100); ok {
+		t.Errorf("Got: %v, want: false", ok)
+	}
+
+	values := make([]ValueType, 1000)
+	for i := range values {
+		values[i] = ValueType(rand.Intn(len(leaves)))
+	}
+
+	buf := &bytes.Buffer{}
+	bw := bitio.NewWriter(buf)
+	for _, v := range values {
+		r, bits, _ := table.Encode(v)
+		if err := bw.WriteBits(r, bits); err != nil {
+			t.Fatalf("Got error: %v", err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatalf("Got error: %v", err)
+	}
+
+	br := NewBitReader(bytes.NewReader(buf.Bytes()))
+	for i, exp := range values {
+		if got, err := table.Decode(br); got != exp || err != nil {
+			t.Fatalf("[%d] Got: %v, %v, want: %v, nil", i, got, err, exp)
+		}
+	}
+	br.Align()
+	if _, err := table.Decode(br); err != io.EOF {
+		t.Errorf("Got: %v, want: %v", err, io.EOF)
+	}
+
+	// Truncated input: the longest code is 39 bits long
+	r, bits, _ := table.Encode(0)
+	buf.Reset()
+	bw = bitio.NewWriter(buf)
+	bw.WriteBits(r>>(bits-16), 16)
+	bw.Close()
+	if _, err := table.Decode(NewBitReader(buf)); err != io.ErrUnexpectedEOF {
+		t.Errorf("Got: %v, want: %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestNewTableCodes(t *testing.T) {
+	cases := []struct {
+		name  string
+		codes []Code
+		err   error
+	}{
+		{"empty", nil, nil},
+		{"single", []Code{{Value: 1}}, nil},
+		{"valid", []Code{{1, 0, 1}, {2, 2, 2}, {3, 3, 2}}, nil},
+		{"incomplete", []Code{{1, 0, 1}, {2, 2, 2}}, nil},
+		{"duplicate", []Code{{1, 0, 1}, {1, 1, 1}}, ErrDuplicateValue},
+		{"prefix", []Code{{1, 0, 1}, {2, 1, 2}}, ErrNotPrefixFree},
+		{"prefix long", []Code{{1, 0, 1}, {2, 1, 20}}, ErrNotPrefixFree},
+		{"too long", []Code{{1, 0, 65}}, ErrCodeTooLong},
+	}
+
+	for _, c := range cases {
+		if _, err := NewTableCodes(c.codes); err != c.err {
+			t.Errorf("[%s] Got: %v, want: %v", c.name, err, c.err)
+		}
+	}
+
+	// Incomplete codes are accepted, but decoding a missing code is an error
+	table, _ := NewTableCodes([]Code{{1, 0, 1}, {2, 2, 2}})
+	if _, err := table.Decode(NewBitReader(bytes.NewReader([]byte{0xff}))); err != ErrInvalidCode {
+		t.Errorf("Got: %v, want: %v", err, ErrInvalidCode)
+	}
+	table, _ = NewTableCodes(nil)
+	if _, err := table.Decode(NewBitReader(bytes.NewReader([]byte{0xff}))); err != ErrInvalidCode {
+		t.Errorf("Got: %v, want: %v", err, ErrInvalidCode)
+	}
+
+	// Single leaf: the 0-bit code is decoded without consuming input, but EOF is detected
+	table, _ = NewTable(&Node{Value: 5})
+	br := NewBitReader(bytes.NewReader([]byte{0xff}))
+	if v, err := table.Decode(br); v != 5 || err != nil {
+		t.Errorf("Got: %v, %v, want: %v, nil", v, err, 5)
+	}
+	br.ReadByte()
+	if _, err := table.Decode(br); err != io.EOF {
+		t.Errorf("Got: %v, want: %v", err, io.EOF)
+	}
+	if _, err := table.Decode(NewBitReader(bytes.NewReader(nil))); err != io.EOF {
+		t.Errorf("Got: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestBitReader(t *testing.T) {
+	br := NewBitReader(bytes.NewReader([]byte{0xa5, 0x0f, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}))
+
+	if u, avail, err := br.PeekBits(4); u != 0xa || avail != 4 || err != nil {
+		t.Errorf("Got: %x, %d, %v, want: a, 4, nil", u, avail, err)
+	}
+	if b, err := br.ReadBool(); !b || err != nil {
+		t.Errorf("Got: %v, %v, want: true, nil", b, err)
+	}
+	if u, err := br.ReadBits(3); u != 0x2 || err != nil {
+		t.Errorf("Got: %x, %v, want: 2, nil", u, err)
+	}
+	if b, err := br.ReadByte(); b != 0x50 || err != nil {
+		t.Errorf("Got: %x, %v, want: 50, nil", b, err)
+	}
+	if skipped := br.Align(); skipped != 4 {
+		t.Errorf("Got: %d, want: 4", skipped)
+	}
+	if u, err := br.ReadBits(64); u != 0x123456789abcdef0 || err != nil {
+		t.Errorf("Got: %x, %v, want: 123456789abcdef0, nil", u, err)
+	}
+	if u, avail, err := br.PeekBits(1); u != 0 || avail != 0 || err != io.EOF {
+		t.Errorf("Got: %x, %d, %v, want: 0, 0, EOF", u, avail, err)
+	}
+
+	br = NewBitReader(bytes.NewReader([]byte{0x12, 0x34}))
+	p := make([]byte, 3)
+	if n, err := br.Read(p); n != 2 || err != io.EOF || p[0] != 0x12 || p[1] != 0x34 {
+		t.Errorf("Got: %d, %v, %x, want: 2, EOF, 1234", n, err, p[:2])
+	}
+}
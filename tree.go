@@ -0,0 +1,277 @@
+/*
+
+Generic Huffman tree implementation.
+
+*/
+
+package huffman
+
+import "io"
+
+// TreeNode is a node in a generic Huffman tree, whose leaves carry values of an arbitrary type T
+// (for example strings for word level codes).
+//
+// TreeNode is the generic counterpart of Node.
+type TreeNode[T any] struct {
+	Parent *TreeNode[T] // Optional parent node, for fast code read-out
+	Left   *TreeNode[T] // Optional left node
+	Right  *TreeNode[T] // Optional right node
+	Count  int          // Relative frequency
+	Value  T            // Optional value, set if this is a leaf
+}
+
+// Code returns the Huffman code of the node.
+// Left children get bit 0, Right children get bit 1.
+// Implementation uses TreeNode.Parent to walk "up" in the tree.
+func (n *TreeNode[T]) Code() (r uint64, bits byte) {
+	for parent := n.Parent; parent != nil; n, parent = parent, parent.Parent {
+		if parent.Right == n { // bit 1
+			r |= 1 << bits
+		} // else bit 0 => nothing to do with r
+		bits++
+	}
+	return
+}
+
+// BuildTree builds a generic Huffman tree from the specified leaves.
+// The passed slice is not modified (only the Parent fields of the leaves are set).
+// Guaranteed that the same input slice will result in the same Huffman tree.
+//
+// BuildTree is the generic counterpart of Build, it results in the same tree shape.
+func BuildTree[T any](leaves []*TreeNode[T]) *TreeNode[T] {
+	return build(leaves, (*TreeNode[T]).count, joinTreeNodes[T])
+}
+
+// BuildTreeSorted builds a generic Huffman tree from the specified leaves which must be sorted by TreeNode.Count.
+// The passed slice is not modified (only the Parent fields of the leaves are set).
+// Guaranteed that the same input slice will result in the same Huffman tree.
+//
+// BuildTreeSorted is the generic counterpart of BuildSorted, it results in the same tree shape.
+func BuildTreeSorted[T any](leaves []*TreeNode[T]) *TreeNode[T] {
+	return buildSorted(leaves, (*TreeNode[T]).count, joinTreeNodes[T])
+}
+
+// count returns the count of the node.
+func (n *TreeNode[T]) count() int { return n.Count }
+
+// joinTreeNodes creates the parent of 2 nodes.
+func joinTreeNodes[T any](left, right *TreeNode[T]) *TreeNode[T] {
+	parent := &TreeNode[T]{Left: left, Right: right, Count: left.Count + right.Count}
+	left.Parent = parent
+	right.Parent = parent
+	return parent
+}
+
+// buildSorted implements the Huffman tree building for any node type N,
+// used by BuildSorted and BuildTreeSorted.
+// leaves must be sorted by count, join must create the parent of 2 nodes.
+//
+// It uses 2 queues: the queue of leaves, and the queue of parents (which are created in non-decreasing
+// count order). It runs in O(n) time, and builds the same tree as if each parent would be inserted
+// into the sorted list of the remaining nodes before the nodes having the same count:
+// the next node is a parent if its count is not greater than that of the next leaf,
+// and parents having the same count are taken newest first (they form a stack).
+func buildSorted[N comparable](leaves []N, count func(N) int, join func(left, right N) N) (root N) {
+	if len(leaves) == 0 {
+		return
+	}
+
+	// Parents are stored in creation order. Groups of parents having the same count
+	// are taken from the end of the group, so only the last group may grow.
+	parents := make([]N, len(leaves)-1)
+	var groups []parentGroup // Groups of parents, in increasing count order
+	var next int             // Index of the next leaf
+
+	// pop removes and returns the next node.
+	pop := func() (n N) {
+		if len(groups) > 0 && (next == len(leaves) || groups[0].count <= count(leaves[next])) {
+			g := &groups[0]
+			g.end--
+			n = parents[g.end]
+			if g.start == g.end {
+				groups = groups[1:]
+			}
+			return
+		}
+		n = leaves[next]
+		next++
+		return
+	}
+
+	for i := 1; i < len(leaves); i++ {
+		left := pop()
+		right := pop()
+		parent := join(left, right)
+		parentCount := count(parent)
+
+		if k := len(groups) - 1; k >= 0 && groups[k].count == parentCount {
+			parents[groups[k].end] = parent
+			groups[k].end++
+		} else {
+			start := 0
+			if k >= 0 {
+				start = groups[k].end
+			}
+			parents[start] = parent
+			groups = append(groups, parentGroup{count: parentCount, start: start, end: start + 1})
+		}
+	}
+
+	return pop()
+}
+
+// parentGroup is a group of parents having the same count, used by buildSorted.
+type parentGroup struct {
+	count      int // Count of the parents
+	start, end int // Parents of the group are parents[start:end]
+}
+
+// build implements the Huffman tree building for any node type N from unsorted leaves,
+// used by Build and BuildTree. join must create the parent of 2 nodes.
+//
+// It uses a binary heap and runs in O(n log n) time. It builds the same tree as buildSorted
+// after stable sorting the leaves by count: nodes are ordered by count, then
+// parents before leaves, parents newest first and leaves in their original order.
+func build[N comparable](leaves []N, count func(N) int, join func(left, right N) N) (root N) {
+	if len(leaves) == 0 {
+		return
+	}
+
+	h := make(nodeHeap[N], len(leaves))
+	for i, leaf := range leaves {
+		h[i] = heapItem[N]{node: leaf, count: count(leaf), prio: i}
+	}
+	h.init()
+
+	for prio := -1; len(h) > 1; prio-- {
+		left := h.pop()
+		right := h.pop()
+		parent := join(left.node, right.node)
+		h.push(heapItem[N]{node: parent, count: count(parent), prio: prio})
+	}
+
+	return h[0].node
+}
+
+// heapItem is an item of nodeHeap.
+type heapItem[N any] struct {
+	node  N
+	count int // Count of the node
+	prio  int // Order of nodes having the same count: index for leaves, decreasing negative numbers for parents
+}
+
+// nodeHeap is a binary min-heap of nodes, ordered by count, then by priority.
+type nodeHeap[N any] []heapItem[N]
+
+// less tells if the ith item is less than the jth.
+func (h nodeHeap[N]) less(i, j int) bool {
+	if h[i].count != h[j].count {
+		return h[i].count < h[j].count
+	}
+	return h[i].prio < h[j].prio
+}
+
+// init establishes the heap invariant.
+func (h nodeHeap[N]) init() {
+	for i := len(h)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+// push pushes an item to the heap.
+func (h *nodeHeap[N]) push(item heapItem[N]) {
+	*h = append(*h, item)
+	h.up(len(*h) - 1)
+}
+
+// pop removes and returns the minimum item of the heap.
+func (h *nodeHeap[N]) pop() heapItem[N] {
+	old := *h
+	n := len(old) - 1
+	item := old[0]
+	old[0] = old[n]
+	*h = old[:n]
+	h.down(0)
+	return item
+}
+
+// up moves the ith item up to its place.
+func (h nodeHeap[N]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h[i], h[parent] = h[parent], h[i]
+		i = parent
+	}
+}
+
+// down moves the ith item down to its place.
+func (h nodeHeap[N]) down(i int) {
+	for {
+		child := 2*i + 1
+		if child >= len(h) {
+			break
+		}
+		if child+1 < len(h) && h.less(child+1, child) {
+			child++
+		}
+		if !h.less(child, i) {
+			break
+		}
+		h[i], h[child] = h[child], h[i]
+		i = child
+	}
+}
+
+// TreeLeaves returns the leaves of the generic Huffman tree, in left-to-right order.
+func TreeLeaves[T any](root *TreeNode[T]) (leaves []*TreeNode[T]) {
+	if root == nil {
+		return nil
+	}
+
+	var traverse func(n *TreeNode[T])
+	traverse = func(n *TreeNode[T]) {
+		if n.Left == nil {
+			leaves = append(leaves, n)
+			return
+		}
+		traverse(n.Left)
+		traverse(n.Right)
+	}
+
+	traverse(root)
+	return
+}
+
+// LeafMap returns a map from values to the leaves of the generic Huffman tree carrying them,
+// which can be used for encoding (see TreeNode.Code).
+func LeafMap[T comparable](root *TreeNode[T]) map[T]*TreeNode[T] {
+	leaves := TreeLeaves(root)
+	m := make(map[T]*TreeNode[T], len(leaves))
+	for _, leaf := range leaves {
+		m[leaf.Value] = leaf
+	}
+	return m
+}
+
+// Decode reads a Huffman code from src, and returns the leaf it denotes in the tree rooted at n.
+// io.EOF is returned if src is at EOF at the start of the code, io.ErrUnexpectedEOF if it ends inside a code.
+func (n *TreeNode[T]) Decode(src *BitReader) (leaf *TreeNode[T], err error) {
+	for leaf = n; leaf.Left != nil; { // read until we reach a leaf
+		var right bool
+		if right, err = src.ReadBool(); err != nil {
+			if err == io.EOF && leaf != n {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if right {
+			leaf = leaf.Right
+		} else {
+			leaf = leaf.Left
+		}
+	}
+	return
+}
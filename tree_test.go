@@ -0,0 +1,107 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/icza/bitio"
+)
+
+func TestBuildTree(t *testing.T) {
+	t1, t2 := BuildTree[string](nil), BuildTree([]*TreeNode[string]{})
+	if t1 != nil || t2 != nil {
+		t.Errorf("Got: %v, %v, want: nil, nil", t1, t2)
+	}
+
+	words := []*TreeNode[string]{
+		{Value: "the", Count: 20},
+		{Value: "a", Count: 40},
+		{Value: "huffman", Count: 7},
+		{Value: "tree", Count: 10},
+		{Value: "code", Count: 8},
+		{Value: "of", Count: 15},
+	}
+	root := BuildTree(words)
+
+	expected := map[string]string{
+		"a":       "0",
+		"tree":    "100",
+		"huffman": "1010",
+		"code":    "1011",
+		"of":      "110",
+		"the":     "111",
+	}
+	leafMap := LeafMap(root)
+	if len(leafMap) != len(expected) {
+		t.Errorf("Got: %d leaves, want: %d", len(leafMap), len(expected))
+	}
+	for word, exp := range expected {
+		r, bits := leafMap[word].Code()
+		if got := formatCode(r, bits); got != exp {
+			t.Errorf("Got: %s, want: %s (word: %q)", got, exp, word)
+		}
+	}
+
+	// Encode and decode
+	text := []string{"the", "huffman", "code", "of", "a", "tree", "a", "the"}
+	buf := &bytes.Buffer{}
+	bw := bitio.NewWriter(buf)
+	for _, word := range text {
+		bw.WriteBits(leafMap[word].Code())
+	}
+	bw.Close()
+	br := NewBitReader(bytes.NewReader(buf.Bytes()))
+	for _, word := range text {
+		leaf, err := root.Decode(br)
+		if err != nil || leaf.Value != word {
+			t.Errorf("Got: %v, %v, want: %q", leaf, err, word)
+		}
+	}
+
+	// 0xff is "111" + "111" + incomplete "11"
+	br = NewBitReader(bytes.NewReader([]byte{0xff}))
+	for _, exp := range []error{nil, nil, io.ErrUnexpectedEOF} {
+		if _, err := root.Decode(br); err != exp {
+			t.Errorf("Got: %v, want: %v", err, exp)
+		}
+	}
+	if _, err := root.Decode(NewBitReader(bytes.NewReader(nil))); err != io.EOF {
+		t.Errorf("Got: %v, want: %v", err, io.EOF)
+	}
+}
+
+func TestBuildTreeSameAsBuild(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		n := rand.Intn(300) + 1
+		leaves := make([]*Node, n)
+		treeLeaves := make([]*TreeNode[ValueType], n)
+		for j := range leaves {
+			count := rand.Intn(rand.Intn(1000) + 1)
+			leaves[j] = &Node{Value: ValueType(j), Count: count}
+			treeLeaves[j] = &TreeNode[ValueType]{Value: ValueType(j), Count: count}
+		}
+
+		ls, tls := Leaves(Build(leaves)), TreeLeaves(BuildTree(treeLeaves))
+		if len(ls) != len(tls) {
+			t.Fatalf("Got: %d leaves, want: %d", len(tls), len(ls))
+		}
+		for j, leaf := range ls {
+			r, bits := leaf.Code()
+			r2, bits2 := tls[j].Code()
+			if leaf.Value != tls[j].Value || r != r2 || bits != bits2 {
+				t.Errorf("Got: %v %s, want: %v %s", tls[j].Value, formatCode(r2, bits2), leaf.Value, formatCode(r, bits))
+			}
+		}
+	}
+}
+
+// formatCode returns the bits of a code as a string, e.g. "0110".
+func formatCode(r uint64, bits byte) string {
+	b := make([]byte, bits)
+	for i := range b {
+		b[i] = '0' + byte(r>>(int(bits)-1-i)&1)
+	}
+	return string(b)
+}